@@ -0,0 +1,273 @@
+package getdns
+
+/*
+#include <getdns/getdns_extra.h>
+
+// The Go callback is passed to getdns as a cgo.Handle in the userarg.
+// cgo cannot take the address of an exported Go function, so supply
+// C routines that pass it to the asynchronous getdns entry points.
+
+extern void callbackGo(getdns_context *context, getdns_callback_type_t callback_type, getdns_dict *response, void *userarg, getdns_transaction_t transaction_id);
+
+getdns_return_t
+address_async(getdns_context *context, const char *name, getdns_dict *extensions, uintptr_t userarg, getdns_transaction_t *transaction_id)
+{
+    return getdns_address(context, name, extensions, (void *) userarg, transaction_id, callbackGo);
+}
+
+getdns_return_t
+general_async(getdns_context *context, const char *name, uint16_t request_type, getdns_dict *extensions, uintptr_t userarg, getdns_transaction_t *transaction_id)
+{
+    return getdns_general(context, name, request_type, extensions, (void *) userarg, transaction_id, callbackGo);
+}
+
+getdns_return_t
+hostname_async(getdns_context *context, getdns_dict *address, getdns_dict *extensions, uintptr_t userarg, getdns_transaction_t *transaction_id)
+{
+    return getdns_hostname(context, address, extensions, (void *) userarg, transaction_id, callbackGo);
+}
+
+getdns_return_t
+service_async(getdns_context *context, const char *name, getdns_dict *extensions, uintptr_t userarg, getdns_transaction_t *transaction_id)
+{
+    return getdns_service(context, name, extensions, (void *) userarg, transaction_id, callbackGo);
+}
+
+#cgo LDFLAGS: -lgetdns
+*/
+import "C"
+
+import (
+    "runtime/cgo"
+    "unsafe"
+)
+
+type asyncRequest struct {
+    c   *Context
+    cb  Callback
+    nta bool
+}
+
+// TransactionID identifies an outstanding asynchronous lookup.
+type TransactionID uint64
+
+// Callback receives the outcome of an asynchronous lookup. If the
+// lookup completed, err is nil. Otherwise err is a CallbackError, and
+// res may still hold the (incomplete) response from getdns.
+type Callback func(res *Result, err error)
+
+// AddressAsync starts an asynchronous Address lookup. cb is called when the
+// lookup finishes while the Context event loop runs.
+func (c *Context) AddressAsync(name string, exts ExtensionSet, cb Callback) (TransactionID, error) {
+    tid, err := c.addressAsync(name, extensionDict(exts), 0, cb)
+    return tid, opError("address", name, err)
+}
+
+func (c *Context) addressAsync(name string, exts Dict, timeout uint64, cb Callback) (TransactionID, error) {
+    exts, nta := c.negativeTrustAnchorExtensions(name, exts)
+    err := checkExtensions(exts)
+    if err != nil {
+        return 0, err
+    }
+    var cexts *C.getdns_dict
+    cexts, err = convertDictToC(exts)
+    defer C.getdns_dict_destroy(cexts)
+    if err != nil {
+        return 0, err
+    }
+    cname := C.CString(name)
+    defer C.free(unsafe.Pointer(cname))
+    var tid C.getdns_transaction_t
+    h := cgo.NewHandle(&asyncRequest{c: c, cb: cb, nta: nta})
+    var rc ReturnCode
+    c.withLock(func() {
+        rc = c.withTimeout(timeout, func() ReturnCode {
+            return ReturnCode(C.address_async(c.ctx, cname, cexts, C.uintptr_t(h), &tid))
+        })
+    })
+    if rc != RETURN_GOOD {
+        h.Delete()
+        return 0, &returnCodeError{rc}
+    }
+
+    return TransactionID(tid), nil
+}
+
+// GeneralAsync starts an asynchronous General lookup. cb is called when the
+// lookup finishes while the Context event loop runs.
+func (c *Context) GeneralAsync(name string, requestType uint, exts ExtensionSet, cb Callback) (TransactionID, error) {
+    tid, err := c.generalAsync(name, requestType, extensionDict(exts), 0, cb)
+    return tid, opError("general", name, err)
+}
+
+func (c *Context) generalAsync(name string, requestType uint, exts Dict, timeout uint64, cb Callback) (TransactionID, error) {
+    exts, nta := c.negativeTrustAnchorExtensions(name, exts)
+    err := checkExtensions(exts)
+    if err != nil {
+        return 0, err
+    }
+    var cexts *C.getdns_dict
+    cexts, err = convertDictToC(exts)
+    defer C.getdns_dict_destroy(cexts)
+    if err != nil {
+        return 0, err
+    }
+    cname := C.CString(name)
+    defer C.free(unsafe.Pointer(cname))
+    var tid C.getdns_transaction_t
+    h := cgo.NewHandle(&asyncRequest{c: c, cb: cb, nta: nta})
+    var rc ReturnCode
+    c.withLock(func() {
+        rc = c.withTimeout(timeout, func() ReturnCode {
+            return ReturnCode(C.general_async(c.ctx, cname, C.uint16_t(requestType), cexts, C.uintptr_t(h), &tid))
+        })
+    })
+    if rc != RETURN_GOOD {
+        h.Delete()
+        return 0, &returnCodeError{rc}
+    }
+
+    return TransactionID(tid), nil
+}
+
+// HostnameAsync starts an asynchronous Hostname lookup. cb is called when the
+// lookup finishes while the Context event loop runs.
+func (c *Context) HostnameAsync(address Dict, exts ExtensionSet, cb Callback) (TransactionID, error) {
+    tid, err := c.hostnameAsync(address, extensionDict(exts), 0, cb)
+    return tid, hostnameOpError(address, err)
+}
+
+func (c *Context) hostnameAsync(address Dict, exts Dict, timeout uint64, cb Callback) (TransactionID, error) {
+    getdnsAddr, err := convertAddressDictToCallTypes(address)
+    if err != nil {
+        return 0, err
+    }
+    err = checkExtensions(exts)
+    if err != nil {
+        return 0, err
+    }
+    var caddr *C.getdns_dict
+    caddr, err = convertDictToC(getdnsAddr)
+    defer C.getdns_dict_destroy(caddr)
+    if err != nil {
+        return 0, err
+    }
+    var cexts *C.getdns_dict
+    cexts, err = convertDictToC(exts)
+    defer C.getdns_dict_destroy(cexts)
+    if err != nil {
+        return 0, err
+    }
+    var tid C.getdns_transaction_t
+    h := cgo.NewHandle(&asyncRequest{c: c, cb: cb})
+    var rc ReturnCode
+    c.withLock(func() {
+        rc = c.withTimeout(timeout, func() ReturnCode {
+            return ReturnCode(C.hostname_async(c.ctx, caddr, cexts, C.uintptr_t(h), &tid))
+        })
+    })
+    if rc != RETURN_GOOD {
+        h.Delete()
+        return 0, &returnCodeError{rc}
+    }
+
+    return TransactionID(tid), nil
+}
+
+// ServiceAsync starts an asynchronous Service lookup. cb is called when the
+// lookup finishes while the Context event loop runs.
+func (c *Context) ServiceAsync(name string, exts ExtensionSet, cb Callback) (TransactionID, error) {
+    tid, err := c.serviceAsync(name, extensionDict(exts), 0, cb)
+    return tid, opError("service", name, err)
+}
+
+func (c *Context) serviceAsync(name string, exts Dict, timeout uint64, cb Callback) (TransactionID, error) {
+    exts, nta := c.negativeTrustAnchorExtensions(name, exts)
+    err := checkExtensions(exts)
+    if err != nil {
+        return 0, err
+    }
+    var cexts *C.getdns_dict
+    cexts, err = convertDictToC(exts)
+    defer C.getdns_dict_destroy(cexts)
+    if err != nil {
+        return 0, err
+    }
+    cname := C.CString(name)
+    defer C.free(unsafe.Pointer(cname))
+    var tid C.getdns_transaction_t
+    h := cgo.NewHandle(&asyncRequest{c: c, cb: cb, nta: nta})
+    var rc ReturnCode
+    c.withLock(func() {
+        rc = c.withTimeout(timeout, func() ReturnCode {
+            return ReturnCode(C.service_async(c.ctx, cname, cexts, C.uintptr_t(h), &tid))
+        })
+    })
+    if rc != RETURN_GOOD {
+        h.Delete()
+        return 0, &returnCodeError{rc}
+    }
+
+    return TransactionID(tid), nil
+}
+
+// Cancel cancels an outstanding asynchronous lookup. The lookup's
+// callback is called with a CALLBACK_CANCEL error.
+func (c *Context) Cancel(tid TransactionID) error {
+    var rc ReturnCode
+    c.withLock(func() {
+        rc = ReturnCode(C.getdns_cancel_callback(c.ctx, C.getdns_transaction_t(tid)))
+    })
+    if rc != RETURN_GOOD {
+        return &returnCodeError{rc}
+    }
+
+    return nil
+}
+
+// Run runs the Context event loop until there are no outstanding
+// asynchronous lookups, calling the lookup callbacks as they finish.
+// Callbacks may start new lookups. Run does not hold the Context
+// lock, so while it runs no other Context method, including the
+// Async, Query and Cancel methods, may be called from another
+// goroutine.
+func (c *Context) Run() {
+    C.getdns_context_run(c.ctx)
+}
+
+// withTimeout runs f with the Context timeout temporarily set to
+// timeout, so that lookups started by f use it. If timeout is 0, f runs
+// with the Context timeout unchanged. The Context lock must be held.
+func (c *Context) withTimeout(timeout uint64, f func() ReturnCode) ReturnCode {
+    if timeout == 0 {
+        return f()
+    }
+    var old C.uint64_t
+    rc := ReturnCode(C.getdns_context_get_timeout(c.ctx, &old))
+    if rc != RETURN_GOOD {
+        return rc
+    }
+    rc = ReturnCode(C.getdns_context_set_timeout(c.ctx, C.uint64_t(timeout)))
+    if rc != RETURN_GOOD {
+        return rc
+    }
+    defer C.getdns_context_set_timeout(c.ctx, old)
+    return f()
+}
+
+// withLock runs f with the Context lock held. Lookup callbacks that
+// getdns makes during f are deferred and called once the lock is
+// released, so they may start new lookups.
+func (c *Context) withLock(f func()) {
+    c.mu.Lock()
+    c.deferCallbacks = true
+    f()
+    c.deferCallbacks = false
+    cbs := c.deferred
+    c.deferred = nil
+    c.mu.Unlock()
+
+    for _, cb := range cbs {
+        cb()
+    }
+}
@@ -0,0 +1,519 @@
+package getdns
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "sync"
+    "time"
+)
+
+// RFC 5011 timer defaults.
+const (
+    DefaultAddHoldDown    = 30 * 24 * time.Hour
+    DefaultRemoveHoldDown = 30 * 24 * time.Hour
+)
+
+// KeyState is the RFC 5011 state of a managed trust anchor key.
+type KeyState int
+
+const (
+    KEY_ADDPEND KeyState = iota + 1
+    KEY_VALID
+    KEY_MISSING
+    KEY_REVOKED
+)
+
+var keyStateNames = map[KeyState]string{
+    KEY_ADDPEND: "AddPend",
+    KEY_VALID:   "Valid",
+    KEY_MISSING: "Missing",
+    KEY_REVOKED: "Revoked",
+}
+
+func (s KeyState) String() string {
+    if name, ok := keyStateNames[s]; ok {
+        return name
+    }
+    return fmt.Sprintf("KeyState(%d)", int(s))
+}
+
+func (s KeyState) MarshalText() ([]byte, error) {
+    if _, ok := keyStateNames[s]; !ok {
+        return nil, fmt.Errorf("unknown key state %d", int(s))
+    }
+    return []byte(s.String()), nil
+}
+
+func (s *KeyState) UnmarshalText(text []byte) error {
+    for state, name := range keyStateNames {
+        if name == string(text) {
+            *s = state
+            return nil
+        }
+    }
+    return fmt.Errorf("unknown key state %q", text)
+}
+
+// ManagedKey is a trust anchor key tracked by a TrustAnchorManager.
+// HoldDown is when an AddPend key may become Valid, or when a Revoked
+// key may be forgotten.
+type ManagedKey struct {
+    State      KeyState    `json:"state"`
+    Key        RdataDNSKEY `json:"key"`
+    FirstSeen  time.Time   `json:"first_seen"`
+    LastChange time.Time   `json:"last_change"`
+    HoldDown   time.Time   `json:"hold_down"`
+}
+
+type autotrustState struct {
+    Zone        string        `json:"zone"`
+    LastRefresh time.Time     `json:"last_refresh"`
+    NextRefresh time.Time     `json:"next_refresh"`
+    Keys        []*ManagedKey `json:"keys"`
+    DS          []*RdataDS    `json:"ds,omitempty"`
+}
+
+// TrustAnchorManager maintains the trust anchors for a zone following
+// RFC 5011. Each refresh fetches the zone's DNSKEY RRset, validates it
+// against the current anchors, updates key states, saves them to the
+// state file and, when the trusted keys change, installs them on the
+// Context.
+//
+// Now, the hold-down times and Fetch may be changed before the first
+// refresh.
+type TrustAnchorManager struct {
+    Zone      string
+    StateFile string
+
+    // Now returns the current time. It defaults to time.Now.
+    Now func() time.Time
+
+    AddHoldDown    time.Duration
+    RemoveHoldDown time.Duration
+
+    // Fetch returns the DNSKEY RRset for the zone with its RRSIGs.
+    // It defaults to a lookup on the Context.
+    Fetch func(ctx context.Context, zone string) (List, error)
+
+    c     *Context
+    mu    sync.Mutex
+    state autotrustState
+}
+
+// NewTrustAnchorManager creates a TrustAnchorManager for zone on c.
+// If stateFile exists, keys are loaded from it. Otherwise the initial
+// DS and DNSKEY anchors for the zone are used; if initial is nil, they
+// are taken from the Context trust anchors. DNSKEY anchors start as
+// Valid; DS anchors are replaced by the matching key when it is first
+// seen.
+func NewTrustAnchorManager(c *Context, zone string, stateFile string, initial List) (*TrustAnchorManager, error) {
+    m := &TrustAnchorManager{
+        Zone:           canonicalName(zone),
+        StateFile:      stateFile,
+        Now:            time.Now,
+        AddHoldDown:    DefaultAddHoldDown,
+        RemoveHoldDown: DefaultRemoveHoldDown,
+        c:              c,
+    }
+
+    b, err := os.ReadFile(stateFile)
+    if err == nil {
+        err = json.Unmarshal(b, &m.state)
+        if err != nil {
+            return nil, fmt.Errorf("%s: %s", stateFile, err)
+        }
+        if canonicalName(m.state.Zone) != m.Zone {
+            return nil, fmt.Errorf("%s: state is for zone %s", stateFile, m.state.Zone)
+        }
+        return m, nil
+    }
+    if !errors.Is(err, os.ErrNotExist) {
+        return nil, err
+    }
+
+    if initial == nil {
+        initial, err = c.DNSSECTrustAnchors()
+        if err != nil {
+            return nil, err
+        }
+    }
+    m.state.Zone = m.Zone
+    now := m.Now()
+    for _, item := range initial {
+        d, ok := item.(Dict)
+        if !ok {
+            return nil, &returnCodeError{RETURN_WRONG_TYPE_REQUESTED}
+        }
+        rr, err := RRFromDict(d)
+        if err != nil {
+            return nil, err
+        }
+        if canonicalName(rr.Name) != m.Zone {
+            continue
+        }
+        rd, err := rr.Decode()
+        if err != nil {
+            return nil, err
+        }
+        switch rd := rd.(type) {
+        case *RdataDS:
+            m.state.DS = append(m.state.DS, rd)
+        case *RdataDNSKEY:
+            if rd.Flags&DNSKEY_FLAG_REVOKE == 0 {
+                m.state.Keys = append(m.state.Keys, &ManagedKey{
+                    State:      KEY_VALID,
+                    Key:        *rd,
+                    FirstSeen:  now,
+                    LastChange: now,
+                })
+            }
+        }
+    }
+    if len(m.state.Keys) == 0 && len(m.state.DS) == 0 {
+        return nil, fmt.Errorf("no trust anchors for zone %s", m.Zone)
+    }
+    return m, nil
+}
+
+// Keys returns a copy of the managed keys.
+func (m *TrustAnchorManager) Keys() []ManagedKey {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    res := make([]ManagedKey, len(m.state.Keys))
+    for i, mk := range m.state.Keys {
+        res[i] = *mk
+    }
+    return res
+}
+
+// TrustAnchors returns the zone's current trust anchors: the Valid and
+// Missing keys, and any initial DS anchors not yet matched to a key.
+func (m *TrustAnchorManager) TrustAnchors() List {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.trustAnchors()
+}
+
+// NextRefresh returns when the DNSKEY RRset should next be fetched.
+func (m *TrustAnchorManager) NextRefresh() time.Time {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.state.NextRefresh
+}
+
+// Install sets the zone's trust anchors on the Context, keeping any
+// anchors it has for other zones.
+func (m *TrustAnchorManager) Install() error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.install()
+}
+
+// Run refreshes the trust anchors when due until ctx is done. Failed
+// refreshes are retried at the RFC 5011 retry interval.
+func (m *TrustAnchorManager) Run(ctx context.Context) error {
+    for {
+        next := m.NextRefresh()
+        if !m.Now().Before(next) {
+            m.Refresh(ctx)
+            continue
+        }
+        t := time.NewTimer(next.Sub(m.Now()))
+        select {
+        case <-ctx.Done():
+            t.Stop()
+            return ctx.Err()
+        case <-t.C:
+        }
+    }
+}
+
+// Refresh fetches and validates the zone's DNSKEY RRset and updates
+// the key states. The state file is saved, and the Context updated if
+// the trust anchors changed. The lookup is cancelled if ctx is done.
+func (m *TrustAnchorManager) Refresh(ctx context.Context) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    now := m.Now()
+    fetch := m.Fetch
+    if fetch == nil {
+        fetch = m.fetch
+    }
+    keyset, err := fetch(ctx, m.Zone)
+    if err == nil {
+        err = m.update(keyset, now)
+    }
+    if err != nil {
+        // Retry at the shortest retry interval RFC 5011 allows.
+        m.state.NextRefresh = now.Add(time.Hour)
+        if serr := m.save(); serr != nil {
+            return serr
+        }
+        return err
+    }
+    return nil
+}
+
+func (m *TrustAnchorManager) update(keyset List, now time.Time) error {
+    var keys []*RdataDNSKEY
+    var ttl uint32
+    var expiry time.Duration = -1
+    for _, item := range keyset {
+        d, ok := item.(Dict)
+        if !ok {
+            return &returnCodeError{RETURN_WRONG_TYPE_REQUESTED}
+        }
+        rr, err := RRFromDict(d)
+        if err != nil {
+            return err
+        }
+        if canonicalName(rr.Name) != m.Zone {
+            continue
+        }
+        rd, err := rr.Decode()
+        if err != nil {
+            return err
+        }
+        switch rd := rd.(type) {
+        case *RdataDNSKEY:
+            keys = append(keys, rd)
+            ttl = rr.TTL
+        case *RdataRRSIG:
+            if rd.TypeCovered != RRTYPE_DNSKEY {
+                continue
+            }
+            ttl = rd.OriginalTTL
+            exp := time.Unix(int64(rd.Expiration), 0).Sub(now)
+            if expiry < 0 || exp < expiry {
+                expiry = exp
+            }
+        }
+    }
+
+    status, err := ValidateDNSSECAt(keyset, nil, m.trustAnchors(), now, 0)
+    if err != nil {
+        return err
+    }
+    if status != DNSSEC_SECURE {
+        return fmt.Errorf("DNSKEY RRset for %s is %s", m.Zone, status)
+    }
+
+    old := m.trustAnchors()
+    seen := make(map[*ManagedKey]bool)
+    for _, key := range keys {
+        if key.Flags&DNSKEY_FLAG_SEP == 0 {
+            continue
+        }
+        mk := m.find(key)
+        if key.Flags&DNSKEY_FLAG_REVOKE != 0 {
+            if mk == nil {
+                continue
+            }
+            seen[mk] = true
+            // A revocation counts only if the revoked key signed the RRset.
+            if mk.State != KEY_REVOKED && m.selfSigned(keyset, key, now) {
+                mk.State = KEY_REVOKED
+                mk.Key = *key
+                mk.LastChange = now
+                mk.HoldDown = now.Add(m.RemoveHoldDown)
+            }
+            continue
+        }
+
+        if mk == nil {
+            mk = &ManagedKey{State: KEY_ADDPEND, Key: *key, FirstSeen: now, LastChange: now}
+            if m.matchDS(key) {
+                mk.State = KEY_VALID
+            } else {
+                hold := m.AddHoldDown
+                if d := time.Duration(ttl) * time.Second; d > hold {
+                    hold = d
+                }
+                mk.HoldDown = now.Add(hold)
+            }
+            m.state.Keys = append(m.state.Keys, mk)
+        }
+        seen[mk] = true
+
+        switch mk.State {
+        case KEY_ADDPEND:
+            if !now.Before(mk.HoldDown) {
+                mk.State = KEY_VALID
+                mk.LastChange = now
+            }
+        case KEY_MISSING:
+            mk.State = KEY_VALID
+            mk.LastChange = now
+        }
+    }
+
+    var keep []*ManagedKey
+    for _, mk := range m.state.Keys {
+        switch {
+        case mk.State == KEY_REVOKED && !now.Before(mk.HoldDown):
+            continue
+        case seen[mk]:
+        case mk.State == KEY_ADDPEND:
+            continue
+        case mk.State == KEY_VALID:
+            mk.State = KEY_MISSING
+            mk.LastChange = now
+        }
+        keep = append(keep, mk)
+    }
+    m.state.Keys = keep
+
+    m.state.LastRefresh = now
+    m.state.NextRefresh = now.Add(refreshInterval(15*24*time.Hour, ttl, expiry))
+    err = m.save()
+    if err != nil {
+        return err
+    }
+    if !equalAnchors(old, m.trustAnchors()) {
+        return m.install()
+    }
+    return nil
+}
+
+// refreshInterval returns the RFC 5011 section 2.3 interval: half the
+// original TTL or signature lifetime, capped at max, and at least an
+// hour. A zero ttl or negative expiry is ignored.
+func refreshInterval(max time.Duration, ttl uint32, expiry time.Duration) time.Duration {
+    res := max
+    if d := time.Duration(ttl) * time.Second / 2; ttl > 0 && d < res {
+        res = d
+    }
+    if d := expiry / 2; expiry >= 0 && d < res {
+        res = d
+    }
+    if res < time.Hour {
+        res = time.Hour
+    }
+    return res
+}
+
+// find returns the managed key with the same public key as key,
+// ignoring the revoke flag.
+func (m *TrustAnchorManager) find(key *RdataDNSKEY) *ManagedKey {
+    for _, mk := range m.state.Keys {
+        if mk.Key.Algorithm == key.Algorithm && mk.Key.Protocol == key.Protocol && bytes.Equal(mk.Key.PublicKey, key.PublicKey) {
+            return mk
+        }
+    }
+    return nil
+}
+
+// matchDS reports whether key matches an initial DS anchor, removing
+// the DS if so.
+func (m *TrustAnchorManager) matchDS(key *RdataDNSKEY) bool {
+    for i, ds := range m.state.DS {
+        if key.MatchesDS(m.Zone, ds) {
+            m.state.DS = append(m.state.DS[:i], m.state.DS[i+1:]...)
+            return true
+        }
+    }
+    return false
+}
+
+func (m *TrustAnchorManager) selfSigned(keyset List, key *RdataDNSKEY, now time.Time) bool {
+    anchor, err := dnskeyAnchor(m.Zone, key)
+    if err != nil {
+        return false
+    }
+    status, err := ValidateDNSSECAt(keyset, nil, List{anchor}, now, 0)
+    return err == nil && status == DNSSEC_SECURE
+}
+
+func (m *TrustAnchorManager) trustAnchors() List {
+    var res List
+    for _, mk := range m.state.Keys {
+        if mk.State != KEY_VALID && mk.State != KEY_MISSING {
+            continue
+        }
+        if d, err := dnskeyAnchor(m.Zone, &mk.Key); err == nil {
+            res = append(res, d)
+        }
+    }
+    for _, ds := range m.state.DS {
+        if d, err := dsAnchor(m.Zone, ds); err == nil {
+            res = append(res, d)
+        }
+    }
+    return res
+}
+
+func (m *TrustAnchorManager) install() error {
+    anchors := m.trustAnchors()
+    var err error
+    m.c.withLock(func() {
+        var cur List
+        cur, err = m.c.DNSSECTrustAnchors()
+        if err != nil {
+            cur = nil
+        }
+        for _, item := range cur {
+            if d, ok := item.(Dict); ok {
+                name, err := dictName(d, "name")
+                if err == nil && canonicalName(name) == m.Zone {
+                    continue
+                }
+            }
+            anchors = append(anchors, item)
+        }
+        err = m.c.SetDNSSECTrustAnchors(anchors)
+    })
+    return err
+}
+
+func (m *TrustAnchorManager) fetch(ctx context.Context, zone string) (List, error) {
+    exts := Dict{"add_opt_parameters": Dict{"do_bit": 1}}
+    res, err := m.c.GeneralContext(ctx, zone, RRTYPE_DNSKEY, exts)
+    if err != nil {
+        return nil, err
+    }
+    defer res.Destroy()
+
+    rt, err := res.RepliesTree()
+    if err != nil {
+        return nil, err
+    }
+    if len(rt) == 0 {
+        return nil, &returnCodeError{RETURN_GENERIC_ERROR}
+    }
+    reply, ok := rt[0].(Dict)
+    if !ok {
+        return nil, &returnCodeError{RETURN_WRONG_TYPE_REQUESTED}
+    }
+    return dictList(reply, "answer")
+}
+
+// save writes the state file, replacing it atomically.
+func (m *TrustAnchorManager) save() error {
+    b, err := json.MarshalIndent(&m.state, "", "  ")
+    if err != nil {
+        return err
+    }
+    tmp := m.StateFile + ".tmp"
+    err = os.WriteFile(tmp, append(b, '\n'), 0644)
+    if err != nil {
+        return err
+    }
+    return os.Rename(tmp, m.StateFile)
+}
+
+func equalAnchors(a, b List) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if val2str(a[i], nil) != val2str(b[i], nil) {
+            return false
+        }
+    }
+    return true
+}
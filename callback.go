@@ -0,0 +1,62 @@
+package getdns
+
+// #include <getdns/getdns_extra.h>
+import "C"
+
+import (
+    "runtime/cgo"
+    "unsafe"
+)
+
+//export callbackGo
+func callbackGo(ctx *C.getdns_context, callbackType C.getdns_callback_type_t, response *C.getdns_dict, userarg unsafe.Pointer, tid C.getdns_transaction_t) {
+    h := cgo.Handle(uintptr(userarg))
+    req := h.Value().(*asyncRequest)
+    h.Delete()
+
+    var res *Result
+    if response != nil {
+        if req.nta {
+            applyNegativeTrustAnchors(response)
+        }
+        res = createResult(response)
+    }
+    var err error
+    if ct := CallbackType(callbackType); ct != CALLBACK_COMPLETE {
+        err = &callbackTypeError{ct}
+    }
+    if c := req.c; c.deferCallbacks {
+        c.deferred = append(c.deferred, func() { req.cb(res, err) })
+        return
+    }
+    req.cb(res, err)
+}
+
+func eventLoopFromHandle(handle C.uintptr_t) *eventLoop {
+    return cgo.Handle(handle).Value().(*eventLoop)
+}
+
+//export eventloopCleanupGo
+func eventloopCleanupGo(handle C.uintptr_t) {
+    eventLoopFromHandle(handle).cleanup()
+}
+
+//export eventloopScheduleGo
+func eventloopScheduleGo(handle C.uintptr_t, fd C.int, timeout C.uint64_t, ev *C.getdns_eventloop_event) C.getdns_return_t {
+    return C.getdns_return_t(eventLoopFromHandle(handle).schedule(int(fd), uint64(timeout), ev))
+}
+
+//export eventloopClearGo
+func eventloopClearGo(handle C.uintptr_t, ev *C.getdns_eventloop_event) C.getdns_return_t {
+    return C.getdns_return_t(eventLoopFromHandle(handle).clear(ev))
+}
+
+//export eventloopRunGo
+func eventloopRunGo(handle C.uintptr_t) {
+    eventLoopFromHandle(handle).run()
+}
+
+//export eventloopRunOnceGo
+func eventloopRunOnceGo(handle C.uintptr_t, blocking C.int) {
+    eventLoopFromHandle(handle).runOnce(blocking != 0)
+}
@@ -33,6 +33,27 @@ const (
     RESPSTATUS_NO_ALL_BOGUS_ANSWERS = C.GETDNS_RESPSTATUS_ALL_BOGUS_ANSWERS
 )
 
+// Asynchronous callback types.
+type CallbackType int
+
+const (
+    CALLBACK_COMPLETE CallbackType = C.GETDNS_CALLBACK_COMPLETE
+    CALLBACK_CANCEL                = C.GETDNS_CALLBACK_CANCEL
+    CALLBACK_TIMEOUT               = C.GETDNS_CALLBACK_TIMEOUT
+    CALLBACK_ERROR                 = C.GETDNS_CALLBACK_ERROR
+)
+
+// DNSSEC status values.
+type DNSSECStatus int
+
+const (
+    DNSSEC_SECURE        DNSSECStatus = C.GETDNS_DNSSEC_SECURE
+    DNSSEC_BOGUS                      = C.GETDNS_DNSSEC_BOGUS
+    DNSSEC_INDETERMINATE              = C.GETDNS_DNSSEC_INDETERMINATE
+    DNSSEC_INSECURE                   = C.GETDNS_DNSSEC_INSECURE
+    DNSSEC_NOT_PERFORMED              = C.GETDNS_DNSSEC_NOT_PERFORMED
+)
+
 // Response anwer types.
 type Nametype int
 
@@ -139,6 +160,15 @@ const (
     RRTYPE_DLV        = C.GETDNS_RRTYPE_DLV
 )
 
+// RR Classes
+const (
+    RRCLASS_IN   = C.GETDNS_RRCLASS_IN
+    RRCLASS_CH   = C.GETDNS_RRCLASS_CH
+    RRCLASS_HS   = C.GETDNS_RRCLASS_HS
+    RRCLASS_NONE = C.GETDNS_RRCLASS_NONE
+    RRCLASS_ANY  = C.GETDNS_RRCLASS_ANY
+)
+
 // Context append name options.
 type AppendName int
 
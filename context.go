@@ -6,13 +6,29 @@ import "C"
 
 import (
     "runtime"
+    "sync"
     "unsafe"
 )
 
+// Context holds getdns configuration and state. The Async, Query and
+// Cancel methods may be called from many goroutines at once, except
+// while Run is running; other methods must not be called concurrently
+// with each other or with outstanding asynchronous lookups.
 type Context struct {
     ctx                  *C.getdns_context
     implementationString string
     versionString        string
+
+    // mu guards the C context against the Go event loop goroutines
+    // used by the Query methods. While it is held, callbacks are
+    // deferred until it is released.
+    mu             sync.Mutex
+    deferCallbacks bool
+    deferred       []func()
+    eventLoop      *eventLoop
+
+    ntaMu sync.Mutex
+    ntas  []NegativeTrustAnchor
 }
 
 func CreateContext(setFromOS bool) (*Context, error) {
@@ -50,25 +66,33 @@ func CreateContext(setFromOS bool) (*Context, error) {
 }
 
 func (c *Context) Destroy() {
-    if ctx := c.ctx; c != nil {
-        c.ctx = nil
-        runtime.SetFinalizer(c, nil)
-        C.getdns_context_destroy(ctx)
-    }
+    c.withLock(func() {
+        if ctx := c.ctx; ctx != nil {
+            c.ctx = nil
+            runtime.SetFinalizer(c, nil)
+            C.getdns_context_destroy(ctx)
+        }
+    })
 }
 
 func (c *Context) IsValid() bool {
     return c.ctx != nil
 }
 
-func (c *Context) Address(name string, exts Dict) (*Result, error) {
-    err := checkExtensions(exts)
+func (c *Context) Address(name string, exts ExtensionSet) (*Result, error) {
+    res, err := c.address(name, exts)
+    return res, opError("address", name, err)
+}
+
+func (c *Context) address(name string, exts ExtensionSet) (*Result, error) {
+    d, nta := c.negativeTrustAnchorExtensions(name, extensionDict(exts))
+    err := checkExtensions(d)
     if err != nil {
         return nil, err
     }
     var res *C.getdns_dict
     var cexts *C.getdns_dict
-    cexts, err = convertDictToC(exts)
+    cexts, err = convertDictToC(d)
     defer C.getdns_dict_destroy(cexts)
     if err != nil {
         return nil, err
@@ -80,17 +104,26 @@ func (c *Context) Address(name string, exts Dict) (*Result, error) {
         return nil, &returnCodeError{rc}
     }
 
+    if nta {
+        applyNegativeTrustAnchors(res)
+    }
     return createResult(res), nil
 }
 
-func (c *Context) General(name string, requestType uint, exts Dict) (*Result, error) {
-    err := checkExtensions(exts)
+func (c *Context) General(name string, requestType uint, exts ExtensionSet) (*Result, error) {
+    res, err := c.general(name, requestType, exts)
+    return res, opError("general", name, err)
+}
+
+func (c *Context) general(name string, requestType uint, exts ExtensionSet) (*Result, error) {
+    d, nta := c.negativeTrustAnchorExtensions(name, extensionDict(exts))
+    err := checkExtensions(d)
     if err != nil {
         return nil, err
     }
     var res *C.getdns_dict
     var cexts *C.getdns_dict
-    cexts, err = convertDictToC(exts)
+    cexts, err = convertDictToC(d)
     defer C.getdns_dict_destroy(cexts)
     if err != nil {
         return nil, err
@@ -102,6 +135,9 @@ func (c *Context) General(name string, requestType uint, exts Dict) (*Result, er
         return nil, &returnCodeError{rc}
     }
 
+    if nta {
+        applyNegativeTrustAnchors(res)
+    }
     return createResult(res), nil
 }
 
@@ -113,12 +149,18 @@ func (c *Context) ApiInformation() (Dict, error) {
     return res, nil
 }
 
-func (c *Context) Hostname(address Dict, exts Dict) (*Result, error) {
+func (c *Context) Hostname(address Dict, exts ExtensionSet) (*Result, error) {
+    res, err := c.hostname(address, exts)
+    return res, hostnameOpError(address, err)
+}
+
+func (c *Context) hostname(address Dict, exts ExtensionSet) (*Result, error) {
     getdnsAddr, err := convertAddressDictToCallTypes(address)
     if err != nil {
         return nil, err
     }
-    err = checkExtensions(exts)
+    d := extensionDict(exts)
+    err = checkExtensions(d)
     if err != nil {
         return nil, err
     }
@@ -130,7 +172,7 @@ func (c *Context) Hostname(address Dict, exts Dict) (*Result, error) {
         return nil, err
     }
     var cexts *C.getdns_dict
-    cexts, err = convertDictToC(exts)
+    cexts, err = convertDictToC(d)
     defer C.getdns_dict_destroy(cexts)
     if err != nil {
         return nil, err
@@ -143,14 +185,20 @@ func (c *Context) Hostname(address Dict, exts Dict) (*Result, error) {
     return createResult(res), nil
 }
 
-func (c *Context) Service(name string, exts Dict) (*Result, error) {
-    err := checkExtensions(exts)
+func (c *Context) Service(name string, exts ExtensionSet) (*Result, error) {
+    res, err := c.service(name, exts)
+    return res, opError("service", name, err)
+}
+
+func (c *Context) service(name string, exts ExtensionSet) (*Result, error) {
+    d, nta := c.negativeTrustAnchorExtensions(name, extensionDict(exts))
+    err := checkExtensions(d)
     if err != nil {
         return nil, err
     }
     var res *C.getdns_dict
     var cexts *C.getdns_dict
-    cexts, err = convertDictToC(exts)
+    cexts, err = convertDictToC(d)
     defer C.getdns_dict_destroy(cexts)
     if err != nil {
         return nil, err
@@ -162,6 +210,9 @@ func (c *Context) Service(name string, exts Dict) (*Result, error) {
         return nil, &returnCodeError{rc}
     }
 
+    if nta {
+        applyNegativeTrustAnchors(res)
+    }
     return createResult(res), nil
 }
 
@@ -0,0 +1,181 @@
+package getdns
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "crypto/sha512"
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "fmt"
+)
+
+// TLSA certificate usages (RFC 7218).
+const (
+    DANE_USAGE_PKIX_TA = 0
+    DANE_USAGE_PKIX_EE = 1
+    DANE_USAGE_DANE_TA = 2
+    DANE_USAGE_DANE_EE = 3
+)
+
+// TLSA selectors.
+const (
+    DANE_SELECTOR_CERT = 0
+    DANE_SELECTOR_SPKI = 1
+)
+
+// TLSA matching types.
+const (
+    DANE_MATCHING_FULL   = 0
+    DANE_MATCHING_SHA256 = 1
+    DANE_MATCHING_SHA512 = 2
+)
+
+// TLSAName returns the TLSA owner name for a service, _port._proto.host.
+func TLSAName(port uint16, proto, host string) string {
+    return fmt.Sprintf("_%d._%s.%s", port, proto, host)
+}
+
+// LookupTLSA looks up the TLSA records for port, proto and host. Only
+// DNSSEC secure answers are accepted.
+func (c *Context) LookupTLSA(ctx context.Context, port uint16, proto, host string) ([]*RdataTLSA, error) {
+    name := TLSAName(port, proto, host)
+    exts := Dict{"dnssec_return_only_secure": EXTENSION_TRUE}
+    res, err := c.GeneralContext(ctx, name, RRTYPE_TLSA, exts)
+    if err != nil {
+        return nil, dnsError(err, name)
+    }
+    defer res.Destroy()
+    rds, err := rdataFromResult(res, name, RRTYPE_TLSA)
+    if err != nil {
+        return nil, err
+    }
+    tlsas := make([]*RdataTLSA, len(rds))
+    for i, rd := range rds {
+        tlsas[i] = rd.(*RdataTLSA)
+    }
+    return tlsas, nil
+}
+
+// DANEVerifyConnection looks up the TLSA records for port, proto and
+// host and returns VerifyDANE for them, checking names against host.
+func (c *Context) DANEVerifyConnection(ctx context.Context, port uint16, proto, host string) (func(tls.ConnectionState) error, error) {
+    tlsas, err := c.LookupTLSA(ctx, port, proto, host)
+    if err != nil {
+        return nil, err
+    }
+    return VerifyDANE(tlsas, host, nil), nil
+}
+
+// VerifyDANE returns a function for tls.Config.VerifyConnection that
+// authenticates the peer using the TLSA records following RFC 6698 and
+// RFC 7671. The connection is accepted if any usable record matches:
+//
+//   - PKIX-TA and PKIX-EE records need the chain to pass PKIX
+//     validation against roots, or the system roots if nil.
+//   - DANE-TA records need the peer certificate to chain to the
+//     matching certificate and to be valid for serverName.
+//   - DANE-EE records need only match the peer certificate.
+//
+// If serverName is empty, the connection's server name is used. If no
+// records are usable, plain PKIX validation is done. DANE-TA and
+// DANE-EE peers often do not pass PKIX validation, so the tls.Config
+// should set InsecureSkipVerify, leaving all checks to this function.
+func VerifyDANE(tlsas []*RdataTLSA, serverName string, roots *x509.CertPool) func(tls.ConnectionState) error {
+    return func(cs tls.ConnectionState) error {
+        certs := cs.PeerCertificates
+        if len(certs) == 0 {
+            return errors.New("dane: no peer certificates")
+        }
+        ee := certs[0]
+        name := serverName
+        if name == "" {
+            name = cs.ServerName
+        }
+        intermediates := x509.NewCertPool()
+        for _, cert := range certs[1:] {
+            intermediates.AddCert(cert)
+        }
+        chains, pkixErr := ee.Verify(x509.VerifyOptions{
+            Roots:         roots,
+            Intermediates: intermediates,
+            DNSName:       name,
+        })
+
+        usable := false
+        for _, tlsa := range tlsas {
+            if !usableTLSA(tlsa) {
+                continue
+            }
+            usable = true
+
+            switch tlsa.CertificateUsage {
+            case DANE_USAGE_PKIX_TA:
+                for _, chain := range chains {
+                    for _, cert := range chain[1:] {
+                        if matchTLSA(tlsa, cert) {
+                            return nil
+                        }
+                    }
+                }
+
+            case DANE_USAGE_PKIX_EE:
+                if pkixErr == nil && matchTLSA(tlsa, ee) {
+                    return nil
+                }
+
+            case DANE_USAGE_DANE_TA:
+                for _, cert := range certs[1:] {
+                    if !matchTLSA(tlsa, cert) {
+                        continue
+                    }
+                    ta := x509.NewCertPool()
+                    ta.AddCert(cert)
+                    _, err := ee.Verify(x509.VerifyOptions{
+                        Roots:         ta,
+                        Intermediates: intermediates,
+                        DNSName:       name,
+                    })
+                    if err == nil {
+                        return nil
+                    }
+                }
+
+            case DANE_USAGE_DANE_EE:
+                if matchTLSA(tlsa, ee) {
+                    return nil
+                }
+            }
+        }
+
+        if !usable {
+            return pkixErr
+        }
+        return errors.New("dane: no TLSA record matches the peer certificates")
+    }
+}
+
+// usableTLSA reports whether the usage, selector and matching type of
+// tlsa are known.
+func usableTLSA(tlsa *RdataTLSA) bool {
+    return tlsa.CertificateUsage <= DANE_USAGE_DANE_EE &&
+        tlsa.Selector <= DANE_SELECTOR_SPKI &&
+        tlsa.MatchingType <= DANE_MATCHING_SHA512
+}
+
+func matchTLSA(tlsa *RdataTLSA, cert *x509.Certificate) bool {
+    data := cert.Raw
+    if tlsa.Selector == DANE_SELECTOR_SPKI {
+        data = cert.RawSubjectPublicKeyInfo
+    }
+    switch tlsa.MatchingType {
+    case DANE_MATCHING_SHA256:
+        sum := sha256.Sum256(data)
+        data = sum[:]
+    case DANE_MATCHING_SHA512:
+        sum := sha512.Sum512(data)
+        data = sum[:]
+    }
+    return bytes.Equal(data, tlsa.Data)
+}
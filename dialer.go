@@ -0,0 +1,236 @@
+package getdns
+
+import (
+    "context"
+    "net"
+    "net/netip"
+    "time"
+)
+
+// DefaultConnectionAttemptDelay is the RFC 8305 recommended delay
+// between connection attempts.
+const DefaultConnectionAttemptDelay = 250 * time.Millisecond
+
+// Dialer connects to addresses, resolving names with a Context. IPv6
+// and IPv4 addresses are tried alternately, racing connections as
+// described in RFC 8305. DialContext can be used as
+// http.Transport.DialContext.
+type Dialer struct {
+    Context *Context
+
+    // NetDialer makes the connections. If nil, a zero net.Dialer is
+    // used.
+    NetDialer *net.Dialer
+
+    // RequireSecure refuses connections to addresses whose answers
+    // are not DNSSEC secure.
+    RequireSecure bool
+
+    // ConnectionAttemptDelay is how long to wait for a connection
+    // before also trying the next address. If zero,
+    // DefaultConnectionAttemptDelay is used.
+    ConnectionAttemptDelay time.Duration
+}
+
+// NewDialer returns a Dialer that resolves names using c.
+func NewDialer(c *Context) *Dialer {
+    return &Dialer{Context: c}
+}
+
+// Dial connects to address on the named network.
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+    return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to address on the named network using ctx.
+// The network must be one of "tcp", "tcp4", "tcp6", "udp", "udp4" or
+// "udp6".
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+    var want func(netip.Addr) bool
+    switch network {
+    case "tcp", "udp":
+        want = func(netip.Addr) bool { return true }
+    case "tcp4", "udp4":
+        want = netip.Addr.Is4
+    case "tcp6", "udp6":
+        want = netip.Addr.Is6
+    default:
+        return nil, &net.OpError{Op: "dial", Net: network, Err: net.UnknownNetworkError(network)}
+    }
+
+    host, port, err := net.SplitHostPort(address)
+    if err != nil {
+        return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+    }
+    if _, err := netip.ParseAddr(host); err == nil {
+        return d.netDialer().DialContext(ctx, network, address)
+    }
+
+    addrs, err := d.resolve(ctx, host)
+    if err != nil {
+        return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+    }
+    var candidates []netip.Addr
+    for _, addr := range addrs {
+        if want(addr) {
+            candidates = append(candidates, addr)
+        }
+    }
+    if len(candidates) == 0 {
+        return nil, &net.OpError{Op: "dial", Net: network, Err: notFoundError(host)}
+    }
+    return d.dialParallel(ctx, network, interleave(candidates), port)
+}
+
+func (d *Dialer) netDialer() *net.Dialer {
+    if d.NetDialer != nil {
+        return d.NetDialer
+    }
+    return &net.Dialer{}
+}
+
+// resolve returns the addresses of host, only from DNSSEC secure
+// replies if RequireSecure is set.
+func (d *Dialer) resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+    exts := Dict{"return_both_v4_and_v6": EXTENSION_TRUE}
+    if d.RequireSecure {
+        exts["dnssec_return_status"] = EXTENSION_TRUE
+    }
+    res, err := d.Context.AddressContext(ctx, host, exts)
+    if err != nil {
+        return nil, dnsError(err, host)
+    }
+    defer res.Destroy()
+    err = statusError(res, host)
+    if err != nil {
+        return nil, err
+    }
+    replies, err := res.Replies()
+    if err != nil {
+        return nil, dnsError(err, host)
+    }
+
+    var addrs []netip.Addr
+    insecure := false
+    for _, reply := range replies {
+        for _, rr := range reply.Answer {
+            if rr.Type != RRTYPE_A && rr.Type != RRTYPE_AAAA {
+                continue
+            }
+            if d.RequireSecure && reply.DNSSECStatus != DNSSEC_SECURE {
+                insecure = true
+                continue
+            }
+            rd, err := rr.Decode()
+            if err != nil {
+                return nil, dnsError(err, host)
+            }
+            var ip net.IP
+            switch rd := rd.(type) {
+            case *RdataA:
+                ip = rd.Address
+            case *RdataAAAA:
+                ip = rd.Address
+            }
+            if addr, ok := netip.AddrFromSlice(ip); ok {
+                addrs = append(addrs, addr.Unmap())
+            }
+        }
+    }
+    if len(addrs) == 0 {
+        if insecure {
+            return nil, &net.DNSError{Err: "no DNSSEC secure addresses", Name: host}
+        }
+        return nil, notFoundError(host)
+    }
+    return addrs, nil
+}
+
+// interleave orders addrs alternating between IPv6 and IPv4, starting
+// with IPv6, keeping the order within each family.
+func interleave(addrs []netip.Addr) []netip.Addr {
+    var v6, v4 []netip.Addr
+    for _, addr := range addrs {
+        if addr.Is6() {
+            v6 = append(v6, addr)
+        } else {
+            v4 = append(v4, addr)
+        }
+    }
+    res := make([]netip.Addr, 0, len(addrs))
+    for len(v6) > 0 || len(v4) > 0 {
+        if len(v6) > 0 {
+            res = append(res, v6[0])
+            v6 = v6[1:]
+        }
+        if len(v4) > 0 {
+            res = append(res, v4[0])
+            v4 = v4[1:]
+        }
+    }
+    return res
+}
+
+// dialParallel connects to the first of addrs to answer. Each attempt
+// starts when the previous one fails or after the connection attempt
+// delay, whichever is first.
+func (d *Dialer) dialParallel(ctx context.Context, network string, addrs []netip.Addr, port string) (net.Conn, error) {
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    delay := d.ConnectionAttemptDelay
+    if delay == 0 {
+        delay = DefaultConnectionAttemptDelay
+    }
+    nd := d.netDialer()
+
+    type result struct {
+        conn net.Conn
+        err  error
+    }
+    results := make(chan result, len(addrs))
+    next, pending := 0, 0
+    start := func() {
+        address := net.JoinHostPort(addrs[next].String(), port)
+        next++
+        pending++
+        go func() {
+            conn, err := nd.DialContext(ctx, network, address)
+            results <- result{conn, err}
+        }()
+    }
+
+    var firstErr error
+    start()
+    for pending > 0 {
+        var timer <-chan time.Time
+        if next < len(addrs) {
+            timer = time.After(delay)
+        }
+        select {
+        case r := <-results:
+            pending--
+            if r.err == nil {
+                // Close any connections that lose the race.
+                go func(n int) {
+                    for ; n > 0; n-- {
+                        if r := <-results; r.conn != nil {
+                            r.conn.Close()
+                        }
+                    }
+                }(pending)
+                return r.conn, nil
+            }
+            if firstErr == nil {
+                firstErr = r.err
+            }
+            if next < len(addrs) {
+                start()
+            }
+
+        case <-timer:
+            start()
+        }
+    }
+    return nil, firstErr
+}
@@ -0,0 +1,137 @@
+package getdns
+
+import (
+    "context"
+    "strings"
+)
+
+// ServiceInstance is a DNS-SD service instance (RFC 6763). Name is the
+// PTR record target, and Domain the domain browsed. Text holds
+// the decoded TXT attributes. DNSSECStatus combines the status of the
+// PTR, SRV and TXT lookups. If Err is set, the instance could not be
+// resolved.
+type ServiceInstance struct {
+    Name         string
+    Instance     string
+    Service      string
+    Domain       string
+    Targets      SRVTargets
+    Text         map[string][]byte
+    DNSSECStatus DNSSECStatus
+    Err          error
+}
+
+// Browse finds the instances of serviceType, such as "_http._tcp", in
+// domain, following the PTR records and resolving each instance's SRV
+// and TXT records.
+func (c *Context) Browse(serviceType, domain string) ([]*ServiceInstance, error) {
+    return c.BrowseContext(context.Background(), serviceType, domain)
+}
+
+// BrowseContext is like Browse, but the lookups are cancelled if ctx
+// is done before they complete.
+func (c *Context) BrowseContext(ctx context.Context, serviceType, domain string) ([]*ServiceInstance, error) {
+    serviceType = strings.Trim(serviceType, ".")
+    domain = canonicalName(domain)
+    ptrs, status, err := c.lookupStatus(ctx, serviceType+"."+domain, RRTYPE_PTR)
+    if err != nil {
+        return nil, err
+    }
+
+    var res []*ServiceInstance
+    for _, rr := range ptrs {
+        name, err := dictName(rr.Rdata, "ptrdname")
+        if err != nil {
+            return nil, err
+        }
+        wire, err := dictBytes(rr.Rdata, "ptrdname")
+        if err != nil {
+            return nil, err
+        }
+        if len(wire) == 0 || int(wire[0]) >= len(wire) {
+            return nil, &returnCodeError{RETURN_BAD_DOMAIN_NAME}
+        }
+        label := string(wire[1 : 1+wire[0]])
+        inst := &ServiceInstance{
+            Name:         name,
+            Instance:     label,
+            Service:      serviceType,
+            Domain:       domain,
+            DNSSECStatus: status,
+        }
+        c.resolveInstance(ctx, inst)
+        res = append(res, inst)
+    }
+    return res, nil
+}
+
+func (c *Context) resolveInstance(ctx context.Context, inst *ServiceInstance) {
+    exts := Dict{"dnssec_return_status": EXTENSION_TRUE}
+    res, err := c.ServiceContext(ctx, inst.Name, exts)
+    if err != nil {
+        inst.Err = dnsError(err, inst.Name)
+        return
+    }
+    defer res.Destroy()
+    err = statusError(res, inst.Name)
+    if err != nil {
+        inst.Err = err
+        return
+    }
+    replies, err := res.Replies()
+    if err != nil {
+        inst.Err = dnsError(err, inst.Name)
+        return
+    }
+    inst.DNSSECStatus = combineDNSSECStatus(inst.DNSSECStatus, repliesStatus(replies))
+    inst.Targets, err = res.SRVTargets()
+    if err != nil {
+        inst.Err = dnsError(err, inst.Name)
+        return
+    }
+
+    txts, status, err := c.lookupStatus(ctx, inst.Name, RRTYPE_TXT)
+    if err != nil {
+        inst.Err = err
+        return
+    }
+    inst.DNSSECStatus = combineDNSSECStatus(inst.DNSSECStatus, status)
+    inst.Text = map[string][]byte{}
+    for _, rr := range txts {
+        rd, err := rr.Decode()
+        if err != nil {
+            inst.Err = dnsError(err, inst.Name)
+            return
+        }
+        for key, val := range DecodeServiceTXT(rd.(*RdataTXT).Strings) {
+            if _, ok := inst.Text[key]; !ok {
+                inst.Text[key] = val
+            }
+        }
+    }
+}
+
+// DecodeServiceTXT decodes DNS-SD TXT record strings to key/value
+// attributes (RFC 6763 section 6). Keys are lower case. A key without
+// "=" is a boolean attribute with a nil value; "key=" has an empty
+// value. Only the first occurrence of a key counts, and strings with
+// an empty key are ignored.
+func DecodeServiceTXT(strs []string) map[string][]byte {
+    res := map[string][]byte{}
+    for _, s := range strs {
+        key, val, hasVal := strings.Cut(s, "=")
+        if key == "" {
+            continue
+        }
+        key = strings.ToLower(key)
+        if _, ok := res[key]; ok {
+            continue
+        }
+        if hasVal {
+            res[key] = []byte(val)
+        } else {
+            res[key] = nil
+        }
+    }
+    return res
+}
@@ -0,0 +1,318 @@
+package getdns
+
+/*
+#cgo LDFLAGS: -lgetdns
+#include <getdns/getdns_extra.h>
+
+// getdns_validate_dnssec2 appeared in getdns 1.1.0. Older releases
+// only validate against the current time.
+
+getdns_return_t
+validate_dnssec_at(getdns_list *records, getdns_list *support, getdns_list *anchors, time_t when, uint32_t skew, int now)
+{
+#if GETDNS_NUMERIC_VERSION >= 0x01010000
+    return getdns_validate_dnssec2(records, support, anchors, when, skew);
+#else
+    if (!now)
+        return GETDNS_RETURN_NOT_IMPLEMENTED;
+    return getdns_validate_dnssec(records, support, anchors);
+#endif
+}
+*/
+import "C"
+
+import (
+    "bytes"
+    "crypto/sha1"
+    "crypto/sha256"
+    "crypto/sha512"
+    "fmt"
+    "sort"
+    "strings"
+    "time"
+)
+
+// DS digest types.
+const (
+    DIGEST_SHA1   = 1
+    DIGEST_SHA256 = 2
+    DIGEST_SHA384 = 4
+)
+
+func (s DNSSECStatus) String() string {
+    switch s {
+    case DNSSEC_SECURE:
+        return "secure"
+    case DNSSEC_BOGUS:
+        return "bogus"
+    case DNSSEC_INDETERMINATE:
+        return "indeterminate"
+    case DNSSEC_INSECURE:
+        return "insecure"
+    case DNSSEC_NOT_PERFORMED:
+        return "not performed"
+    default:
+        return fmt.Sprintf("DNSSECStatus(%d)", int(s))
+    }
+}
+
+// ChainLink holds the DNSSEC records in a validation chain for one
+// zone: the DS records from the parent zone, the zone's DNSKEY
+// records, and the signatures over each. Other holds any remaining
+// records at or below the zone, such as NSEC or NSEC3 records proving
+// an insecure delegation, with their signatures.
+type ChainLink struct {
+    Zone       string
+    DS         []RR
+    DSSigs     []RR
+    DNSKEY     []RR
+    DNSKEYSigs []RR
+    Other      []RR
+}
+
+// ValidationChain is a DNSSEC validation chain grouped by zone. Links
+// are ordered from the root towards the answer.
+type ValidationChain struct {
+    Links []*ChainLink
+}
+
+// DNSSECChain returns the typed validation chain from the result.
+// The lookup must use the dnssec_return_validation_chain extension.
+func (r *Result) DNSSECChain() (*ValidationChain, error) {
+    l, err := r.ValidationChain()
+    if err != nil {
+        return nil, err
+    }
+    return ValidationChainFromList(l)
+}
+
+// ValidationChainFromList groups a list of RR dicts, as returned by
+// Result.ValidationChain, into a ValidationChain.
+func ValidationChainFromList(l List) (*ValidationChain, error) {
+    rrs, err := RRsFromList(l)
+    if err != nil {
+        return nil, err
+    }
+
+    res := &ValidationChain{}
+    var other []RR
+    for _, rr := range rrs {
+        rrtype := rr.Type
+        if rrtype == RRTYPE_RRSIG {
+            rrtype, err = coveredType(rr)
+            if err != nil {
+                return nil, err
+            }
+        }
+        switch rrtype {
+        case RRTYPE_DS, RRTYPE_DNSKEY:
+            res.add(rr, rrtype)
+        default:
+            other = append(other, rr)
+        }
+    }
+
+    for _, rr := range other {
+        link := res.enclosing(rr.Name)
+        if link == nil {
+            link = res.link(rr.Name)
+        }
+        link.Other = append(link.Other, rr)
+    }
+
+    sort.SliceStable(res.Links, func(i, j int) bool {
+        return labelCount(res.Links[i].Zone) < labelCount(res.Links[j].Zone)
+    })
+    return res, nil
+}
+
+// Link returns the link for zone, or nil if there is none.
+func (vc *ValidationChain) Link(zone string) *ChainLink {
+    zone = canonicalName(zone)
+    for _, link := range vc.Links {
+        if link.Zone == zone {
+            return link
+        }
+    }
+    return nil
+}
+
+func (vc *ValidationChain) link(zone string) *ChainLink {
+    link := vc.Link(zone)
+    if link == nil {
+        link = &ChainLink{Zone: canonicalName(zone)}
+        vc.Links = append(vc.Links, link)
+    }
+    return link
+}
+
+func (vc *ValidationChain) add(rr RR, rrtype uint16) {
+    link := vc.link(rr.Name)
+    sig := rr.Type == RRTYPE_RRSIG
+    switch {
+    case rrtype == RRTYPE_DS && sig:
+        link.DSSigs = append(link.DSSigs, rr)
+    case rrtype == RRTYPE_DS:
+        link.DS = append(link.DS, rr)
+    case sig:
+        link.DNSKEYSigs = append(link.DNSKEYSigs, rr)
+    default:
+        link.DNSKEY = append(link.DNSKEY, rr)
+    }
+}
+
+// enclosing returns the link for the closest zone containing name.
+func (vc *ValidationChain) enclosing(name string) *ChainLink {
+    name = canonicalName(name)
+    var res *ChainLink
+    for _, link := range vc.Links {
+        if isSubdomain(name, link.Zone) && (res == nil || labelCount(link.Zone) > labelCount(res.Zone)) {
+            res = link
+        }
+    }
+    return res
+}
+
+// SecureEntryPoints returns the zone's DNSKEYs that match one of its
+// DS records. If there are DS records but no matching keys, the chain
+// of trust is broken at this zone.
+func (link *ChainLink) SecureEntryPoints() ([]*RdataDNSKEY, error) {
+    var res []*RdataDNSKEY
+    for _, keyrr := range link.DNSKEY {
+        rd, err := keyrr.Decode()
+        if err != nil {
+            return nil, err
+        }
+        key := rd.(*RdataDNSKEY)
+        for _, dsrr := range link.DS {
+            rd, err := dsrr.Decode()
+            if err != nil {
+                return nil, err
+            }
+            if key.MatchesDS(link.Zone, rd.(*RdataDS)) {
+                res = append(res, key)
+                break
+            }
+        }
+    }
+    return res, nil
+}
+
+// Digest returns the DS digest of the DNSKEY owned by owner, using
+// the given digest type.
+func (r *RdataDNSKEY) Digest(owner string, digestType uint8) ([]byte, error) {
+    name, err := ConvertFQDNToDNSName(canonicalName(owner))
+    if err != nil {
+        return nil, err
+    }
+    data := append(name, byte(r.Flags>>8), byte(r.Flags), r.Protocol, r.Algorithm)
+    data = append(data, r.PublicKey...)
+
+    switch digestType {
+    case DIGEST_SHA1:
+        sum := sha1.Sum(data)
+        return sum[:], nil
+    case DIGEST_SHA256:
+        sum := sha256.Sum256(data)
+        return sum[:], nil
+    case DIGEST_SHA384:
+        sum := sha512.Sum384(data)
+        return sum[:], nil
+    default:
+        return nil, &returnCodeError{RETURN_NOT_IMPLEMENTED}
+    }
+}
+
+// MatchesDS reports whether the DNSKEY owned by owner matches ds.
+func (r *RdataDNSKEY) MatchesDS(owner string, ds *RdataDS) bool {
+    if r.Algorithm != ds.Algorithm || r.KeyTag() != ds.KeyTag {
+        return false
+    }
+    digest, err := r.Digest(owner, ds.DigestType)
+    return err == nil && bytes.Equal(digest, ds.Digest)
+}
+
+func coveredType(rr RR) (uint16, error) {
+    covered, err := dictInt(rr.Rdata, "type_covered")
+    return uint16(covered), err
+}
+
+// canonicalName returns the lower case FQDN form of name.
+func canonicalName(name string) string {
+    name = strings.ToLower(name)
+    if !strings.HasSuffix(name, ".") {
+        name += "."
+    }
+    return name
+}
+
+// isSubdomain reports whether name is at or below zone. Both must be
+// canonical.
+func isSubdomain(name, zone string) bool {
+    return zone == "." || name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+func labelCount(name string) int {
+    if name == "." {
+        return 0
+    }
+    return strings.Count(name, ".")
+}
+
+// ValidateDNSSEC validates records against the DNSKEY, DS and RRSIG
+// records in supportRecords, such as those in Result.ValidationChain,
+// and the trust anchors, in the form used by Context.DNSSECTrustAnchors.
+// Signatures are checked against the current time.
+func ValidateDNSSEC(records, supportRecords, trustAnchors List) (DNSSECStatus, error) {
+    return validateDNSSEC(records, supportRecords, trustAnchors, time.Now(), 0, true)
+}
+
+// ValidateDNSSECAt is like ValidateDNSSEC, but checks signatures as
+// at time when, allowing skew seconds of clock skew. This allows
+// archived records to be validated after their signatures expire.
+// It needs getdns 1.1.0 or later, and gives RETURN_NOT_IMPLEMENTED
+// with older releases.
+func ValidateDNSSECAt(records, supportRecords, trustAnchors List, when time.Time, skew uint32) (DNSSECStatus, error) {
+    return validateDNSSEC(records, supportRecords, trustAnchors, when, skew, false)
+}
+
+// validateDNSSEC validates records as at when. now says when is the
+// current time, so older getdns releases can validate too.
+func validateDNSSEC(records, supportRecords, trustAnchors List, when time.Time, skew uint32, now bool) (DNSSECStatus, error) {
+    crecords, err := convertListToC(nonNilList(records))
+    if err != nil {
+        return 0, err
+    }
+    defer C.getdns_list_destroy(crecords)
+    csupport, err := convertListToC(nonNilList(supportRecords))
+    if err != nil {
+        return 0, err
+    }
+    defer C.getdns_list_destroy(csupport)
+    canchors, err := convertListToC(nonNilList(trustAnchors))
+    if err != nil {
+        return 0, err
+    }
+    defer C.getdns_list_destroy(canchors)
+
+    // The result is a DNSSEC status unless validation failed.
+    cnow := C.int(0)
+    if now {
+        cnow = 1
+    }
+    rc := C.validate_dnssec_at(crecords, csupport, canchors, C.time_t(when.Unix()), C.uint32_t(skew), cnow)
+    switch status := DNSSECStatus(rc); status {
+    case DNSSEC_SECURE, DNSSEC_BOGUS, DNSSEC_INDETERMINATE, DNSSEC_INSECURE, DNSSEC_NOT_PERFORMED:
+        return status, nil
+    }
+    return 0, &returnCodeError{ReturnCode(rc)}
+}
+
+// nonNilList returns l, or an empty list if l is nil, so it converts
+// to an empty getdns list rather than NULL.
+func nonNilList(l List) List {
+    if l == nil {
+        return List{}
+    }
+    return l
+}
@@ -0,0 +1,288 @@
+package getdns
+
+import (
+    "encoding/binary"
+    "fmt"
+    "net/netip"
+    "time"
+)
+
+// EDNS(0) option codes.
+const (
+    EDNS_OPTION_NSID          = 3
+    EDNS_OPTION_CLIENT_SUBNET = 8
+    EDNS_OPTION_COOKIE        = 10
+    EDNS_OPTION_TCP_KEEPALIVE = 11
+    EDNS_OPTION_PADDING       = 12
+    EDNS_OPTION_EDE           = 15
+)
+
+// Extended DNS Error info-codes (RFC 8914).
+type EDECode uint16
+
+const (
+    EDE_OTHER                        EDECode = 0
+    EDE_UNSUPPORTED_DNSKEY_ALGORITHM EDECode = 1
+    EDE_UNSUPPORTED_DS_DIGEST_TYPE   EDECode = 2
+    EDE_STALE_ANSWER                 EDECode = 3
+    EDE_FORGED_ANSWER                EDECode = 4
+    EDE_DNSSEC_INDETERMINATE         EDECode = 5
+    EDE_DNSSEC_BOGUS                 EDECode = 6
+    EDE_SIGNATURE_EXPIRED            EDECode = 7
+    EDE_SIGNATURE_NOT_YET_VALID      EDECode = 8
+    EDE_DNSKEY_MISSING               EDECode = 9
+    EDE_RRSIGS_MISSING               EDECode = 10
+    EDE_NO_ZONE_KEY_BIT_SET          EDECode = 11
+    EDE_NSEC_MISSING                 EDECode = 12
+    EDE_CACHED_ERROR                 EDECode = 13
+    EDE_NOT_READY                    EDECode = 14
+    EDE_BLOCKED                      EDECode = 15
+    EDE_CENSORED                     EDECode = 16
+    EDE_FILTERED                     EDECode = 17
+    EDE_PROHIBITED                   EDECode = 18
+    EDE_STALE_NXDOMAIN_ANSWER        EDECode = 19
+    EDE_NOT_AUTHORITATIVE            EDECode = 20
+    EDE_NOT_SUPPORTED                EDECode = 21
+    EDE_NO_REACHABLE_AUTHORITY       EDECode = 22
+    EDE_NETWORK_ERROR                EDECode = 23
+    EDE_INVALID_DATA                 EDECode = 24
+)
+
+var edeNames = []string{
+    "Other",
+    "Unsupported DNSKEY Algorithm",
+    "Unsupported DS Digest Type",
+    "Stale Answer",
+    "Forged Answer",
+    "DNSSEC Indeterminate",
+    "DNSSEC Bogus",
+    "Signature Expired",
+    "Signature Not Yet Valid",
+    "DNSKEY Missing",
+    "RRSIGs Missing",
+    "No Zone Key Bit Set",
+    "NSEC Missing",
+    "Cached Error",
+    "Not Ready",
+    "Blocked",
+    "Censored",
+    "Filtered",
+    "Prohibited",
+    "Stale NXDOMAIN Answer",
+    "Not Authoritative",
+    "Not Supported",
+    "No Reachable Authority",
+    "Network Error",
+    "Invalid Data",
+}
+
+// String returns the IANA name of the info-code.
+func (c EDECode) String() string {
+    if int(c) < len(edeNames) {
+        return edeNames[c]
+    }
+    return fmt.Sprintf("EDE %d", uint16(c))
+}
+
+// EDNSOptionData is the decoded data of an EDNS(0) option. The
+// concrete type depends on the option code; options without a decoder
+// give an *EDNSUnknown.
+type EDNSOptionData interface {
+    OptionCode() uint16
+}
+
+// EDNSClientSubnet is a Client Subnet option (RFC 7871). In queries
+// Prefix is the client subnet and ScopePrefixLen is zero; in replies
+// ScopePrefixLen is the prefix length the answer applies to.
+type EDNSClientSubnet struct {
+    Prefix         netip.Prefix
+    ScopePrefixLen uint8
+}
+
+// EDNSPadding is a Padding option (RFC 7830) of Length zero bytes.
+type EDNSPadding struct {
+    Length int
+}
+
+// EDNSCookie is a DNS Cookie option (RFC 7873). Client is 8 bytes;
+// Server is empty or 8 to 32 bytes.
+type EDNSCookie struct {
+    Client []byte
+    Server []byte
+}
+
+// EDNSTCPKeepalive is an edns-tcp-keepalive option (RFC 7828).
+// Queries carry no timeout. Timeout has a resolution of 100ms.
+type EDNSTCPKeepalive struct {
+    HasTimeout bool
+    Timeout    time.Duration
+}
+
+// EDNSNSID is a Name Server Identifier option (RFC 5001). Queries
+// carry an empty ID.
+type EDNSNSID struct {
+    ID []byte
+}
+
+// EDNSExtendedError is an Extended DNS Error option (RFC 8914).
+type EDNSExtendedError struct {
+    InfoCode  EDECode
+    ExtraText string
+}
+
+// EDNSUnknown holds the raw data of an option without a decoder.
+type EDNSUnknown struct {
+    Code uint16
+    Data []byte
+}
+
+func (*EDNSClientSubnet) OptionCode() uint16  { return EDNS_OPTION_CLIENT_SUBNET }
+func (*EDNSPadding) OptionCode() uint16       { return EDNS_OPTION_PADDING }
+func (*EDNSCookie) OptionCode() uint16        { return EDNS_OPTION_COOKIE }
+func (*EDNSTCPKeepalive) OptionCode() uint16  { return EDNS_OPTION_TCP_KEEPALIVE }
+func (*EDNSNSID) OptionCode() uint16          { return EDNS_OPTION_NSID }
+func (*EDNSExtendedError) OptionCode() uint16 { return EDNS_OPTION_EDE }
+func (o *EDNSUnknown) OptionCode() uint16     { return o.Code }
+
+// Decode returns the typed data of the option.
+func (o EDNSOption) Decode() (EDNSOptionData, error) {
+    return DecodeEDNSOption(o.Code, o.Data)
+}
+
+// DecodeEDNSOption decodes the data of an EDNS(0) option. If there is
+// no decoder for the code, the result is an *EDNSUnknown.
+func DecodeEDNSOption(code uint16, data []byte) (EDNSOptionData, error) {
+    switch code {
+    case EDNS_OPTION_CLIENT_SUBNET:
+        if len(data) < 4 {
+            return nil, &returnCodeError{RETURN_GENERIC_ERROR}
+        }
+        family := binary.BigEndian.Uint16(data)
+        source, scope := int(data[2]), data[3]
+        var buf [16]byte
+        var addr netip.Addr
+        switch family {
+        case 1:
+            if source > 32 || len(data)-4 > 4 {
+                return nil, &returnCodeError{RETURN_GENERIC_ERROR}
+            }
+            copy(buf[:4], data[4:])
+            addr = netip.AddrFrom4([4]byte(buf[:4]))
+        case 2:
+            if source > 128 || len(data)-4 > 16 {
+                return nil, &returnCodeError{RETURN_GENERIC_ERROR}
+            }
+            copy(buf[:], data[4:])
+            addr = netip.AddrFrom16(buf)
+        default:
+            return nil, &returnCodeError{RETURN_GENERIC_ERROR}
+        }
+        return &EDNSClientSubnet{
+            Prefix:         netip.PrefixFrom(addr, source),
+            ScopePrefixLen: scope,
+        }, nil
+
+    case EDNS_OPTION_PADDING:
+        return &EDNSPadding{Length: len(data)}, nil
+
+    case EDNS_OPTION_COOKIE:
+        if len(data) != 8 && (len(data) < 16 || len(data) > 40) {
+            return nil, &returnCodeError{RETURN_GENERIC_ERROR}
+        }
+        res := &EDNSCookie{Client: append([]byte(nil), data[:8]...)}
+        if len(data) > 8 {
+            res.Server = append([]byte(nil), data[8:]...)
+        }
+        return res, nil
+
+    case EDNS_OPTION_TCP_KEEPALIVE:
+        switch len(data) {
+        case 0:
+            return &EDNSTCPKeepalive{}, nil
+        case 2:
+            timeout := time.Duration(binary.BigEndian.Uint16(data)) * 100 * time.Millisecond
+            return &EDNSTCPKeepalive{HasTimeout: true, Timeout: timeout}, nil
+        default:
+            return nil, &returnCodeError{RETURN_GENERIC_ERROR}
+        }
+
+    case EDNS_OPTION_NSID:
+        return &EDNSNSID{ID: append([]byte(nil), data...)}, nil
+
+    case EDNS_OPTION_EDE:
+        if len(data) < 2 {
+            return nil, &returnCodeError{RETURN_GENERIC_ERROR}
+        }
+        return &EDNSExtendedError{
+            InfoCode:  EDECode(binary.BigEndian.Uint16(data)),
+            ExtraText: string(data[2:]),
+        }, nil
+
+    default:
+        return &EDNSUnknown{Code: code, Data: append([]byte(nil), data...)}, nil
+    }
+}
+
+// EncodeEDNSOption encodes typed option data as an EDNSOption, for
+// the Options of OptParameters.
+func EncodeEDNSOption(o EDNSOptionData) (EDNSOption, error) {
+    res := EDNSOption{Code: o.OptionCode()}
+    switch o := o.(type) {
+    case *EDNSClientSubnet:
+        if !o.Prefix.IsValid() {
+            return res, &returnCodeError{RETURN_INVALID_PARAMETER}
+        }
+        prefix := o.Prefix.Masked()
+        addr := prefix.Addr()
+        bits := prefix.Bits()
+        if o.Prefix.Addr().Is4In6() {
+            addr = addr.Unmap()
+            bits -= 96
+            if bits < 0 {
+                return res, &returnCodeError{RETURN_INVALID_PARAMETER}
+            }
+        }
+        family := uint16(1)
+        if addr.Is6() {
+            family = 2
+        }
+        res.Data = binary.BigEndian.AppendUint16(nil, family)
+        res.Data = append(res.Data, byte(bits), o.ScopePrefixLen)
+        res.Data = append(res.Data, addr.AsSlice()[:(bits+7)/8]...)
+
+    case *EDNSPadding:
+        if o.Length < 0 || o.Length > 0xffff {
+            return res, &returnCodeError{RETURN_INVALID_PARAMETER}
+        }
+        res.Data = make([]byte, o.Length)
+
+    case *EDNSCookie:
+        if len(o.Client) != 8 || (len(o.Server) != 0 && (len(o.Server) < 8 || len(o.Server) > 32)) {
+            return res, &returnCodeError{RETURN_INVALID_PARAMETER}
+        }
+        res.Data = append(append([]byte(nil), o.Client...), o.Server...)
+
+    case *EDNSTCPKeepalive:
+        if o.HasTimeout {
+            units := o.Timeout / (100 * time.Millisecond)
+            if units < 0 || units > 0xffff {
+                return res, &returnCodeError{RETURN_INVALID_PARAMETER}
+            }
+            res.Data = binary.BigEndian.AppendUint16(nil, uint16(units))
+        }
+
+    case *EDNSNSID:
+        res.Data = append([]byte(nil), o.ID...)
+
+    case *EDNSExtendedError:
+        res.Data = binary.BigEndian.AppendUint16(nil, uint16(o.InfoCode))
+        res.Data = append(res.Data, o.ExtraText...)
+
+    case *EDNSUnknown:
+        res.Data = append([]byte(nil), o.Data...)
+
+    default:
+        return res, &returnCodeError{RETURN_INVALID_PARAMETER}
+    }
+    return res, nil
+}
@@ -0,0 +1,157 @@
+package getdns
+
+import (
+    "context"
+    "errors"
+    "fmt"
+)
+
+// Errors for each getdns return code. Errors with a return code match
+// the error for the code with errors.Is.
+var (
+    ErrGenericError             error = &returnCodeError{RETURN_GENERIC_ERROR}
+    ErrBadDomainName            error = &returnCodeError{RETURN_BAD_DOMAIN_NAME}
+    ErrBadContext               error = &returnCodeError{RETURN_BAD_CONTEXT}
+    ErrContextUpdateFail        error = &returnCodeError{RETURN_UPDATE_FAIL}
+    ErrUnknownTransaction       error = &returnCodeError{RETURN_UNKNOWN_TRANSACTION}
+    ErrNoSuchListItem           error = &returnCodeError{RETURN_NO_SUCH_LIST_ITEM}
+    ErrNoSuchDictName           error = &returnCodeError{RETURN_NO_SUCH_DICT_NAME}
+    ErrWrongTypeRequested       error = &returnCodeError{RETURN_WRONG_TYPE_REQUESTED}
+    ErrNoSuchExtension          error = &returnCodeError{RETURN_NO_SUCH_EXTENSION}
+    ErrExtensionMisformat       error = &returnCodeError{RETURN_EXTENSION_MISFORMAT}
+    ErrDNSSECWithStubDisallowed error = &returnCodeError{RETURN_DNSSEC_WITH_STUB_DISALLOWED}
+    ErrMemoryError              error = &returnCodeError{RETURN_MEMORY_ERROR}
+    ErrInvalidParameter         error = &returnCodeError{RETURN_INVALID_PARAMETER}
+    ErrNotImplemented           error = &returnCodeError{RETURN_NOT_IMPLEMENTED}
+)
+
+// OpError is the error returned by the Context lookup methods, other
+// than the ctx error from the Context variants. Op is the lookup, such
+// as "address", and Name or Addr the name or address looked up.
+type OpError struct {
+    Op   string
+    Name string
+    Addr string
+    Err  error
+}
+
+func (err *OpError) Error() string {
+    s := "getdns " + err.Op
+    if err.Name != "" {
+        s += " " + err.Name
+    }
+    if err.Addr != "" {
+        s += " " + err.Addr
+    }
+    return s + ": " + err.Err.Error()
+}
+
+func (err *OpError) Unwrap() error {
+    return err.Err
+}
+
+// ReturnCode returns the getdns return code of the underlying error,
+// or RETURN_GENERIC_ERROR if it has none.
+func (err *OpError) ReturnCode() ReturnCode {
+    var gderr Error
+    if errors.As(err.Err, &gderr) {
+        return gderr.ReturnCode()
+    }
+    return RETURN_GENERIC_ERROR
+}
+
+// Timeout reports whether the lookup timed out.
+func (err *OpError) Timeout() bool {
+    var cberr CallbackError
+    if errors.As(err.Err, &cberr) {
+        return cberr.CallbackType() == CALLBACK_TIMEOUT
+    }
+    return errors.Is(err.Err, context.DeadlineExceeded)
+}
+
+// opError wraps a non-nil err from lookup op of name in an *OpError.
+func opError(op, name string, err error) error {
+    if err == nil {
+        return nil
+    }
+    return &OpError{Op: op, Name: name, Err: err}
+}
+
+// hostnameOpError wraps a non-nil err from a hostname lookup of
+// address in an *OpError.
+func hostnameOpError(address Dict, err error) error {
+    if err == nil {
+        return nil
+    }
+    addr, _ := address["address_data"].(string)
+    return &OpError{Op: "hostname", Addr: addr, Err: err}
+}
+
+// responseStatusText returns the description of a response status.
+func responseStatusText(status uint32) string {
+    switch status {
+    case RESPSTATUS_GOOD:
+        return "good"
+    case RESPSTATUS_NO_NAME:
+        return "no such name"
+    case RESPSTATUS_ALL_TIMEOUT:
+        return "all queries timed out"
+    case RESPSTATUS_NO_SECURE_ANSWERS:
+        return "no secure answers"
+    case RESPSTATUS_NO_ALL_BOGUS_ANSWERS:
+        return "all answers bogus"
+    default:
+        return fmt.Sprintf("status %d", status)
+    }
+}
+
+// NoNameError reports a lookup with response status
+// RESPSTATUS_NO_NAME.
+type NoNameError struct{}
+
+func (*NoNameError) Error() string {
+    return "getdns response: " + responseStatusText(RESPSTATUS_NO_NAME)
+}
+
+// AllTimeoutError reports a lookup with response status
+// RESPSTATUS_ALL_TIMEOUT.
+type AllTimeoutError struct{}
+
+func (*AllTimeoutError) Error() string {
+    return "getdns response: " + responseStatusText(RESPSTATUS_ALL_TIMEOUT)
+}
+func (*AllTimeoutError) Timeout() bool   { return true }
+func (*AllTimeoutError) Temporary() bool { return true }
+
+// NoSecureAnswersError reports a lookup with response status
+// RESPSTATUS_NO_SECURE_ANSWERS.
+type NoSecureAnswersError struct{}
+
+func (*NoSecureAnswersError) Error() string {
+    return "getdns response: " + responseStatusText(RESPSTATUS_NO_SECURE_ANSWERS)
+}
+
+// AllBogusError reports a lookup with response status
+// RESPSTATUS_NO_ALL_BOGUS_ANSWERS.
+type AllBogusError struct{}
+
+func (*AllBogusError) Error() string {
+    return "getdns response: " + responseStatusText(RESPSTATUS_NO_ALL_BOGUS_ANSWERS)
+}
+
+// responseStatusError returns the error type for status, or nil if it
+// has none.
+func responseStatusError(status uint32) error {
+    switch status {
+    case RESPSTATUS_NO_NAME:
+        return &NoNameError{}
+    case RESPSTATUS_ALL_TIMEOUT:
+        return &AllTimeoutError{}
+    case RESPSTATUS_NO_SECURE_ANSWERS:
+        return &NoSecureAnswersError{}
+    case RESPSTATUS_NO_ALL_BOGUS_ANSWERS:
+        return &AllBogusError{}
+    default:
+        return nil
+    }
+}
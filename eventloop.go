@@ -0,0 +1,306 @@
+package getdns
+
+/*
+#include <poll.h>
+#include <getdns/getdns_extra.h>
+
+// A getdns_eventloop whose methods are implemented in Go. The loop
+// carries a cgo.Handle for the Go eventLoop.
+
+extern void eventloopCleanupGo(uintptr_t handle);
+extern getdns_return_t eventloopScheduleGo(uintptr_t handle, int fd, uint64_t timeout, getdns_eventloop_event *ev);
+extern getdns_return_t eventloopClearGo(uintptr_t handle, getdns_eventloop_event *ev);
+extern void eventloopRunGo(uintptr_t handle);
+extern void eventloopRunOnceGo(uintptr_t handle, int blocking);
+
+typedef struct go_eventloop {
+    getdns_eventloop loop;
+    uintptr_t handle;
+} go_eventloop;
+
+static void
+go_eventloop_cleanup(getdns_eventloop *loop)
+{
+    go_eventloop *l = (go_eventloop *) loop;
+
+    eventloopCleanupGo(l->handle);
+    free(l);
+}
+
+static getdns_return_t
+go_eventloop_schedule(getdns_eventloop *loop, int fd, uint64_t timeout, getdns_eventloop_event *ev)
+{
+    return eventloopScheduleGo(((go_eventloop *) loop)->handle, fd, timeout, ev);
+}
+
+static getdns_return_t
+go_eventloop_clear(getdns_eventloop *loop, getdns_eventloop_event *ev)
+{
+    return eventloopClearGo(((go_eventloop *) loop)->handle, ev);
+}
+
+static void
+go_eventloop_run(getdns_eventloop *loop)
+{
+    eventloopRunGo(((go_eventloop *) loop)->handle);
+}
+
+static void
+go_eventloop_run_once(getdns_eventloop *loop, int blocking)
+{
+    eventloopRunOnceGo(((go_eventloop *) loop)->handle, blocking);
+}
+
+static getdns_eventloop_vmt go_eventloop_vmt = {
+    go_eventloop_cleanup,
+    go_eventloop_schedule,
+    go_eventloop_clear,
+    go_eventloop_run,
+    go_eventloop_run_once
+};
+
+static getdns_eventloop *
+go_eventloop_create(uintptr_t handle)
+{
+    go_eventloop *l = malloc(sizeof(go_eventloop));
+
+    if (l == NULL)
+        return NULL;
+    l->loop.vmt = &go_eventloop_vmt;
+    l->handle = handle;
+    return &l->loop;
+}
+
+enum { EVENT_READ, EVENT_WRITE, EVENT_TIMEOUT };
+
+static void
+eventloop_fire(getdns_eventloop_event *ev, int which)
+{
+    getdns_eventloop_callback cb;
+
+    switch (which) {
+    case EVENT_READ:    cb = ev->read_cb; break;
+    case EVENT_WRITE:   cb = ev->write_cb; break;
+    default:            cb = ev->timeout_cb; break;
+    }
+    if (cb != NULL)
+        cb(ev->userarg);
+}
+
+static int
+fd_ready(int fd, int write)
+{
+    struct pollfd pfd;
+
+    pfd.fd = fd;
+    pfd.events = write ? POLLOUT : POLLIN;
+    pfd.revents = 0;
+    return poll(&pfd, 1, 0) > 0;
+}
+
+#cgo LDFLAGS: -lgetdns
+*/
+import "C"
+
+import (
+    "os"
+    "runtime/cgo"
+    "sync"
+    "syscall"
+    "time"
+    "unsafe"
+)
+
+// timeoutForever is the getdns event timeout meaning no timeout.
+const timeoutForever = ^uint64(0)
+
+// eventLoop is a getdns event loop run by the Go runtime. Sockets are
+// waited on with the runtime network poller and timeouts with Go
+// timers, each in its own goroutine. Event callbacks are made with
+// the Context lock held.
+type eventLoop struct {
+    c      *Context
+    handle cgo.Handle
+    events map[*C.getdns_eventloop_event]*loopEvent
+
+    // fired is signalled whenever an event callback is made or an
+    // event cleared.
+    fired *sync.Cond
+}
+
+type loopEvent struct {
+    ev    *C.getdns_eventloop_event
+    file  *os.File
+    timer *time.Timer
+}
+
+// SetGoEventLoop replaces the Context event loop with one run by the
+// Go runtime. Asynchronous lookups then proceed in goroutines waiting
+// on the Go network poller, rather than needing Run.
+func (c *Context) SetGoEventLoop() error {
+    _, err := c.setGoEventLoop(func() bool { return true })
+    return err
+}
+
+// setGoEventLoop installs the Go event loop if install, called with
+// the Context lock held, returns true. It reports whether the loop
+// was installed.
+func (c *Context) setGoEventLoop(install func() bool) (bool, error) {
+    l := &eventLoop{
+        c:      c,
+        events: make(map[*C.getdns_eventloop_event]*loopEvent),
+        fired:  sync.NewCond(&c.mu),
+    }
+    l.handle = cgo.NewHandle(l)
+    loop := C.go_eventloop_create(C.uintptr_t(l.handle))
+    if loop == nil {
+        l.handle.Delete()
+        return false, &returnCodeError{RETURN_MEMORY_ERROR}
+    }
+
+    rc := RETURN_GOOD
+    installed := false
+    c.withLock(func() {
+        if !install() {
+            return
+        }
+        rc = ReturnCode(C.getdns_context_set_eventloop(c.ctx, loop))
+        if rc == RETURN_GOOD {
+            c.eventLoop = l
+            installed = true
+        }
+    })
+    if !installed {
+        C.free(unsafe.Pointer(loop))
+        l.handle.Delete()
+        if rc != RETURN_GOOD {
+            return false, &returnCodeError{rc}
+        }
+    }
+
+    return installed, nil
+}
+
+func (l *eventLoop) schedule(fd int, timeout uint64, ev *C.getdns_eventloop_event) ReturnCode {
+    e := &loopEvent{ev: ev}
+    if fd >= 0 && (ev.read_cb != nil || ev.write_cb != nil) {
+        // getdns owns the socket, so watch a duplicate that can be
+        // closed when the event is cleared.
+        dup, err := syscall.Dup(fd)
+        if err != nil {
+            return RETURN_GENERIC_ERROR
+        }
+        syscall.CloseOnExec(dup)
+        e.file = os.NewFile(uintptr(dup), "getdns")
+        rc, err := e.file.SyscallConn()
+        if err != nil {
+            e.file.Close()
+            return RETURN_GENERIC_ERROR
+        }
+        if ev.read_cb != nil {
+            go l.watch(e, rc, C.EVENT_READ)
+        }
+        if ev.write_cb != nil {
+            go l.watch(e, rc, C.EVENT_WRITE)
+        }
+    }
+    if timeout != timeoutForever && ev.timeout_cb != nil {
+        e.timer = time.AfterFunc(time.Duration(timeout)*time.Millisecond, func() {
+            l.fire(e, C.EVENT_TIMEOUT)
+        })
+    }
+    l.events[ev] = e
+    return RETURN_GOOD
+}
+
+func (l *eventLoop) clear(ev *C.getdns_eventloop_event) ReturnCode {
+    e, ok := l.events[ev]
+    if !ok {
+        return RETURN_GENERIC_ERROR
+    }
+    delete(l.events, ev)
+    e.stop()
+    l.fired.Broadcast()
+    return RETURN_GOOD
+}
+
+func (l *eventLoop) cleanup() {
+    for ev, e := range l.events {
+        delete(l.events, ev)
+        e.stop()
+    }
+    if l.c.eventLoop == l {
+        l.c.eventLoop = nil
+    }
+    l.handle.Delete()
+    l.fired.Broadcast()
+}
+
+// run waits until no events are scheduled.
+func (l *eventLoop) run() {
+    l.c.mu.Lock()
+    for len(l.events) > 0 {
+        l.fired.Wait()
+    }
+    l.c.mu.Unlock()
+}
+
+// runOnce waits, if blocking, until an event callback is made.
+func (l *eventLoop) runOnce(blocking bool) {
+    if !blocking {
+        return
+    }
+    l.c.mu.Lock()
+    if len(l.events) > 0 {
+        l.fired.Wait()
+    }
+    l.c.mu.Unlock()
+}
+
+// watch waits on the socket for read or write readiness and fires
+// the event callback, until the event is cleared.
+func (l *eventLoop) watch(e *loopEvent, rc syscall.RawConn, which C.int) {
+    write := C.int(0)
+    if which == C.EVENT_WRITE {
+        write = 1
+    }
+    ready := func(fd uintptr) bool {
+        return C.fd_ready(C.int(fd), write) != 0
+    }
+    for {
+        var err error
+        if write != 0 {
+            err = rc.Write(ready)
+        } else {
+            err = rc.Read(ready)
+        }
+        if err != nil || !l.fire(e, which) {
+            return
+        }
+    }
+}
+
+// fire makes an event callback, if the event is still scheduled.
+// It reports whether the event remains scheduled afterwards.
+func (l *eventLoop) fire(e *loopEvent, which C.int) bool {
+    live := false
+    l.c.withLock(func() {
+        if l.events[e.ev] != e {
+            return
+        }
+        C.eventloop_fire(e.ev, which)
+        l.fired.Broadcast()
+        live = l.events[e.ev] == e
+    })
+    return live
+}
+
+func (e *loopEvent) stop() {
+    if e.file != nil {
+        // Closing the file wakes any watch goroutines.
+        e.file.Close()
+    }
+    if e.timer != nil {
+        e.timer.Stop()
+    }
+}
@@ -0,0 +1,253 @@
+package getdns
+
+import (
+    "time"
+)
+
+// ExtensionSet holds the extensions for a lookup. It is implemented by
+// Dict, for extensions given by name, and by *Extensions. A nil
+// ExtensionSet requests no extensions.
+type ExtensionSet interface {
+    extensionDict() Dict
+}
+
+func (d Dict) extensionDict() Dict {
+    return d
+}
+
+func extensionDict(exts ExtensionSet) Dict {
+    if exts == nil {
+        return nil
+    }
+    return exts.extensionDict()
+}
+
+type extensionKind int
+
+const (
+    extensionBool extensionKind = iota
+    extensionInt
+    extensionOptParameters
+    extensionHeader
+)
+
+// extensionSpec describes an extension's value and the getdns versions
+// that have it, from minVersion up to but not including maxVersion. A
+// zero maxVersion has no upper limit.
+type extensionSpec struct {
+    kind       extensionKind
+    minVersion uint32
+    maxVersion uint32
+}
+
+func (spec extensionSpec) supported() bool {
+    return libraryVersion >= spec.minVersion && (spec.maxVersion == 0 || libraryVersion < spec.maxVersion)
+}
+
+// extensionSpecs lists the known extensions. Only the call reporting
+// extension depends on the version: getdns 0.9.0 renamed
+// return_call_debugging to return_call_reporting. The linked getdns
+// rejects other extensions it does not have.
+var extensionSpecs = map[string]extensionSpec{
+    "add_warning_for_bad_dns":             {kind: extensionBool},
+    "dnssec_return_status":                {kind: extensionBool},
+    "dnssec_return_all_statuses":          {kind: extensionBool},
+    "dnssec_return_only_secure":           {kind: extensionBool},
+    "dnssec_return_validation_chain":      {kind: extensionBool},
+    "dnssec_return_full_validation_chain": {kind: extensionBool},
+    "dnssec_roadblock_avoidance":          {kind: extensionBool},
+    "edns_cookies":                        {kind: extensionBool},
+    "return_api_information":              {kind: extensionBool},
+    "return_both_v4_and_v6":               {kind: extensionBool},
+    "return_call_debugging":               {kind: extensionBool, maxVersion: 0x00090000},
+    "return_call_reporting":               {kind: extensionBool, minVersion: 0x00090000},
+    "specify_class":                       {kind: extensionInt},
+    "add_opt_parameters":                  {kind: extensionOptParameters},
+    "header":                              {kind: extensionHeader},
+}
+
+// Extensions are the getdns lookup extensions as typed fields. Zero
+// values leave an extension unset. Extensions the linked getdns does
+// not have are rejected by getdns when used.
+type Extensions struct {
+    AddWarningForBadDNS             bool
+    DNSSECReturnStatus              bool
+    DNSSECReturnAllStatuses         bool
+    DNSSECReturnOnlySecure          bool
+    DNSSECReturnValidationChain     bool
+    DNSSECReturnFullValidationChain bool
+    DNSSECRoadblockAvoidance        bool
+    EDNSCookies                     bool
+    ReturnAPIInformation            bool
+    ReturnBothV4AndV6               bool
+    ReturnCallReporting             bool
+    SpecifyClass                    uint16
+    AddOptParameters                *OptParameters
+
+    // Header sets the header of outgoing queries. All flags and the
+    // opcode and rcode are set, so RD must be set for recursive
+    // queries. A zero ID leaves getdns to choose it; the counts are
+    // ignored.
+    Header *Header
+}
+
+// OptParameters are the OPT record settings of the add_opt_parameters
+// extension. A zero MaximumUDPPayloadSize and nil ExtendedRcode,
+// Version and DoBit leave the Context settings.
+type OptParameters struct {
+    MaximumUDPPayloadSize uint16
+    ExtendedRcode         *uint8
+    Version               *uint8
+    DoBit                 *bool
+    Options               []EDNSOption
+}
+
+// EDNSOption is an EDNS(0) option code and its data. Use
+// EncodeEDNSOption to make one from typed option data.
+type EDNSOption struct {
+    Code uint16
+    Data []byte
+}
+
+func (e *Extensions) extensionDict() Dict {
+    return e.Dict()
+}
+
+// Dict returns the extensions as a Dict of named extensions.
+func (e *Extensions) Dict() Dict {
+    if e == nil {
+        return nil
+    }
+    res := Dict{}
+    flags := []struct {
+        key string
+        set bool
+    }{
+        {"add_warning_for_bad_dns", e.AddWarningForBadDNS},
+        {"dnssec_return_status", e.DNSSECReturnStatus},
+        {"dnssec_return_all_statuses", e.DNSSECReturnAllStatuses},
+        {"dnssec_return_only_secure", e.DNSSECReturnOnlySecure},
+        {"dnssec_return_validation_chain", e.DNSSECReturnValidationChain},
+        {"dnssec_return_full_validation_chain", e.DNSSECReturnFullValidationChain},
+        {"dnssec_roadblock_avoidance", e.DNSSECRoadblockAvoidance},
+        {"edns_cookies", e.EDNSCookies},
+        {"return_api_information", e.ReturnAPIInformation},
+        {"return_both_v4_and_v6", e.ReturnBothV4AndV6},
+        {returnCallReportingKey(), e.ReturnCallReporting},
+    }
+    for _, f := range flags {
+        if f.set {
+            res[f.key] = EXTENSION_TRUE
+        }
+    }
+    if e.SpecifyClass != 0 {
+        res["specify_class"] = int(e.SpecifyClass)
+    }
+    if opt := e.AddOptParameters; opt != nil {
+        optd := Dict{}
+        if opt.MaximumUDPPayloadSize != 0 {
+            optd["maximum_udp_payload_size"] = int(opt.MaximumUDPPayloadSize)
+        }
+        if opt.ExtendedRcode != nil {
+            optd["extended_rcode"] = int(*opt.ExtendedRcode)
+        }
+        if opt.Version != nil {
+            optd["version"] = int(*opt.Version)
+        }
+        if opt.DoBit != nil {
+            optd["do_bit"] = boolInt(*opt.DoBit)
+        }
+        if len(opt.Options) > 0 {
+            options := make(List, len(opt.Options))
+            for i, o := range opt.Options {
+                options[i] = Dict{"option_code": int(o.Code), "option_data": o.Data}
+            }
+            optd["options"] = options
+        }
+        res["add_opt_parameters"] = optd
+    }
+    if h := e.Header; h != nil {
+        hd := Dict{
+            "qr":     boolInt(h.QR),
+            "opcode": h.Opcode,
+            "aa":     boolInt(h.AA),
+            "tc":     boolInt(h.TC),
+            "rd":     boolInt(h.RD),
+            "ra":     boolInt(h.RA),
+            "z":      h.Z,
+            "ad":     boolInt(h.AD),
+            "cd":     boolInt(h.CD),
+            "rcode":  h.Rcode,
+        }
+        if h.ID != 0 {
+            hd["id"] = int(h.ID)
+        }
+        res["header"] = hd
+    }
+    return res
+}
+
+func boolInt(b bool) int {
+    if b {
+        return 1
+    }
+    return 0
+}
+
+// CallReport describes one query made for a lookup, from the
+// call_reporting list returned with the return_call_reporting
+// extension.
+type CallReport struct {
+    QueryName string
+    QueryType uint16
+    // QueryTo is the upstream queried, as an address dict.
+    QueryTo   Dict
+    RunTime   time.Duration
+    Transport Transport
+}
+
+// CallReporting returns the reports of the queries made for the
+// lookup. The lookup must have used the return_call_reporting
+// extension.
+func (r *Result) CallReporting() ([]CallReport, error) {
+    full, err := r.RepliesFull()
+    if err != nil {
+        return nil, err
+    }
+    l, err := dictList(full, "call_reporting")
+    if err != nil {
+        return nil, err
+    }
+
+    res := make([]CallReport, 0, len(l))
+    for _, item := range l {
+        d, ok := item.(Dict)
+        if !ok {
+            return nil, &returnCodeError{RETURN_WRONG_TYPE_REQUESTED}
+        }
+        var report CallReport
+        if _, ok := d["query_name"]; ok {
+            report.QueryName, err = dictName(d, "query_name")
+            if err != nil {
+                return nil, err
+            }
+        }
+        if qt, err := dictInt(d, "query_type"); err == nil {
+            report.QueryType = uint16(qt)
+        }
+        if ms, err := dictInt(d, "run_time/ms"); err == nil {
+            report.RunTime = time.Duration(ms) * time.Millisecond
+        }
+        if tr, err := dictInt(d, "transport"); err == nil {
+            report.Transport = Transport(tr)
+        }
+        if to, err := dictDict(d, "query_to"); err == nil {
+            report.QueryTo, err = convertAddressDictToUserTypes(to)
+            if err != nil {
+                report.QueryTo = to
+            }
+        }
+        res = append(res, report)
+    }
+    return res, nil
+}
@@ -37,6 +37,43 @@ func (err *returnCodeError) Error() string {
     return fmt.Sprintf("getdns error %d: %s", err.rc, C.GoString(C.getdns_get_errorstr_by_id(C.uint16_t(err.rc))))
 }
 
+// Is reports whether target is an error with the same return code, so
+// errors.Is matches the Err variables.
+func (err *returnCodeError) Is(target error) bool {
+    t, ok := target.(*returnCodeError)
+    return ok && t.rc == err.rc
+}
+
+// CallbackError reports an asynchronous lookup that did not complete.
+type CallbackError interface {
+    error
+    CallbackType() CallbackType
+}
+
+type callbackTypeError struct {
+    ct CallbackType
+}
+
+// CallbackType returns the getdns callback type.
+func (err *callbackTypeError) CallbackType() CallbackType {
+    return err.ct
+}
+
+// Error implements the error interface and returns a printable
+// description of the error.
+func (err *callbackTypeError) Error() string {
+    switch err.ct {
+    case CALLBACK_CANCEL:
+        return "getdns callback: lookup cancelled"
+    case CALLBACK_TIMEOUT:
+        return "getdns callback: lookup timed out"
+    case CALLBACK_ERROR:
+        return "getdns callback: lookup failed"
+    default:
+        return fmt.Sprintf("getdns callback: unexpected type %d", err.ct)
+    }
+}
+
 // ConvertDNSNametoFQDN converts a name in DNS label format to a FQDN.
 // It reimplements the getdns library routine in pure Go rather than
 // calling into the library.
@@ -66,8 +103,13 @@ func ConvertDNSNameToFQDN(b []byte) (string, error) {
 // It reimplements the getdns library routine in pure Go rather than
 // calling into the library. This implementation does not insist that
 // the name is in fact a FQDN; "www.example.com" produces the same
-// output as "www.example.com.".
+// output as "www.example.com.", and both "" and "." give the root
+// name.
 func ConvertFQDNToDNSName(s string) ([]byte, error) {
+    s = strings.TrimSuffix(s, ".")
+    if s == "" {
+        return []byte{0}, nil
+    }
     chunks := strings.Split(s, ".")
     reslen := len(chunks) + 1
     for _, c := range chunks {
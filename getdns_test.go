@@ -1,7 +1,32 @@
 package getdns_test
 
 import (
+    "bytes"
+    "context"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/sha512"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/base64"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "math/big"
+    "net"
+    "net/http"
+    "net/netip"
+    "os"
+    "path/filepath"
+    "reflect"
+    "sort"
+    "strings"
+    "sync"
     "testing"
+    "time"
 
     "getdns"
 )
@@ -26,6 +51,66 @@ func TestNameConversion(t *testing.T) {
     }
 }
 
+func TestNameToDNSName(t *testing.T) {
+    tests := []string{"example.com", "example.com.", ".", ""}
+    answers := [][]byte{
+        {7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0},
+        {7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0},
+        {0},
+        {0},
+    }
+    for i, s := range tests {
+        label, err := getdns.ConvertFQDNToDNSName(s)
+        if err != nil {
+            t.Errorf("Name to DNS error: %s", err)
+            continue
+        }
+        if !bytes.Equal(label, answers[i]) {
+            t.Errorf("Name to DNS conversion of %s: %v != %v", s, label, answers[i])
+        }
+    }
+}
+
+func TestDNSSECStatus(t *testing.T) {
+    var s getdns.DNSSECStatus = getdns.DNSSEC_BOGUS
+    if s.String() != "bogus" {
+        t.Errorf("Bad DNSSEC status string: %s", s)
+    }
+}
+
+func TestValidationChainFromList(t *testing.T) {
+    var l getdns.List
+    for _, s := range []string{
+        ". 172800 IN DNSKEY 257 3 8 AwEAAaz/tAm8yTn4Mfeh5eyI96WSVexTBAvkMgJzkKTOiW1vkIbzxeF3+/4RgWOq7HrxRixHlFlExOLAJr5emLvN7SWXgnLh4+B5xQlNVz8Og8kvArMtNROxVQuCaSnIDdD5LKyWbRd2n9WGe2R8PzgCmr3EgVLrjyBxWezF0jLHwVN8efS3rCj/EWgvIWgb9tarpVUDK/b58Da+sqqls3eNbuv7pr+eoZG+SrDK6nWeL3c6H5Apxz7LjVc1uTIdsIXxuOLYA4/ilBmSVIzuDWfdRUfhHdY6+cn8HFRm+2hM8AnXGXws9555KrUB5qihylGa8subX2Nn6UwNR1AkUTV74bU=",
+        ". 172800 IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+        "net. 86400 IN DS 35886 8 2 7862B27F5F516EBE19680444D4CE5E762981931842C465F00236401D8BD973EE",
+    } {
+        rr, err := getdns.StringToRRDict(s, "", 3600)
+        if err != nil {
+            t.Fatalf("StringToRRDict failed: %s", err)
+        }
+        l = append(l, rr)
+    }
+
+    vc, err := getdns.ValidationChainFromList(l)
+    if err != nil {
+        t.Fatalf("ValidationChainFromList failed: %s", err)
+    }
+    if len(vc.Links) != 2 || vc.Links[0].Zone != "." || vc.Links[1].Zone != "net." {
+        t.Fatalf("Bad chain links: %+v", vc.Links)
+    }
+    seps, err := vc.Link(".").SecureEntryPoints()
+    if err != nil {
+        t.Fatalf("SecureEntryPoints failed: %s", err)
+    }
+    if len(seps) != 1 || seps[0].KeyTag() != 20326 {
+        t.Errorf("Root KSK does not match DS: %v", seps)
+    }
+    if len(vc.Link("net").DS) != 1 {
+        t.Error("No net. DS")
+    }
+}
+
 func TestContextCreate(t *testing.T) {
     c, err := getdns.CreateContext(true)
     if c == nil {
@@ -263,6 +348,1430 @@ func TestHostname(t *testing.T) {
     }
 }
 
+func TestAsync(t *testing.T) {
+    c, err := getdns.CreateContext(true)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+
+    done := 0
+    _, err = c.AddressAsync("www.lunch.org.uk", nil, func(res *getdns.Result, err error) {
+        done++
+        if err != nil {
+            t.Errorf("Address callback error: %s", err)
+            return
+        }
+        status, err := res.Status()
+        if err != nil || status != getdns.RESPSTATUS_GOOD {
+            t.Errorf("Bad Address status: %d", status)
+        }
+    })
+    if err != nil {
+        t.Fatalf("AddressAsync failed: %s", err)
+    }
+
+    _, err = c.GeneralAsync("lunch.org.uk", getdns.RRTYPE_MX, nil, func(res *getdns.Result, err error) {
+        done++
+        if err != nil {
+            t.Errorf("General callback error: %s", err)
+        }
+    })
+    if err != nil {
+        t.Fatalf("GeneralAsync failed: %s", err)
+    }
+
+    tid, err := c.ServiceAsync("_imap._tcp.gmail.com", nil, func(res *getdns.Result, err error) {
+        done++
+        cberr, ok := err.(getdns.CallbackError)
+        if !ok || cberr.CallbackType() != getdns.CALLBACK_CANCEL {
+            t.Errorf("Service callback not cancelled: %v", err)
+        }
+    })
+    if err != nil {
+        t.Fatalf("ServiceAsync failed: %s", err)
+    }
+    err = c.Cancel(tid)
+    if err != nil {
+        t.Errorf("Cancel failed: %s", err)
+    }
+
+    c.Run()
+    if done != 3 {
+        t.Errorf("Only %d callbacks called", done)
+    }
+}
+
+func TestQuery(t *testing.T) {
+    c, err := getdns.CreateContext(true)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+
+    qa, err := c.AddressQuery("www.lunch.org.uk", nil)
+    if err != nil {
+        t.Fatalf("AddressQuery failed: %s", err)
+    }
+    qg, err := c.GeneralQuery("lunch.org.uk", getdns.RRTYPE_MX, nil)
+    if err != nil {
+        t.Fatalf("GeneralQuery failed: %s", err)
+    }
+
+    timeout := time.After(10 * time.Second)
+    for n := 0; n < 2; n++ {
+        var r getdns.Response
+        select {
+        case r = <-qa.C:
+        case r = <-qg.C:
+        case <-timeout:
+            t.Fatal("Query timed out")
+        }
+        if r.Err != nil {
+            t.Errorf("Query error: %s", r.Err)
+            continue
+        }
+        status, err := r.Result.Status()
+        if err != nil || status != getdns.RESPSTATUS_GOOD {
+            t.Errorf("Bad Query status: %d", status)
+        }
+    }
+}
+
+func TestLookupContext(t *testing.T) {
+    c, err := getdns.CreateContext(true)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    res, err := c.GeneralContext(ctx, "lunch.org.uk", getdns.RRTYPE_MX, nil)
+    if err != nil {
+        t.Fatalf("GeneralContext failed: %s", err)
+    }
+    status, err := res.Status()
+    if err != nil || status != getdns.RESPSTATUS_GOOD {
+        t.Errorf("Bad GeneralContext status: %d", status)
+    }
+
+    ctx, cancel = context.WithCancel(context.Background())
+    cancel()
+    _, err = c.AddressContext(ctx, "www.lunch.org.uk", nil)
+    if err != context.Canceled {
+        t.Errorf("AddressContext not cancelled: %v", err)
+    }
+
+    ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+    defer cancel()
+    _, err = c.ServiceContext(ctx, "_imap._tcp.gmail.com", nil)
+    if err != context.DeadlineExceeded {
+        t.Errorf("ServiceContext deadline not exceeded: %v", err)
+    }
+}
+
+func TestGoEventLoop(t *testing.T) {
+    c, err := getdns.CreateContext(true)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+
+    err = c.SetGoEventLoop()
+    if err != nil {
+        t.Fatalf("SetGoEventLoop failed: %s", err)
+    }
+
+    names := []string{"www.lunch.org.uk", "lunch.org.uk", "getdnsapi.net"}
+    errs := make(chan error, len(names))
+    for _, name := range names {
+        go func(name string) {
+            ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+            defer cancel()
+            _, err := c.AddressContext(ctx, name, nil)
+            errs <- err
+        }(name)
+    }
+    for range names {
+        if err := <-errs; err != nil {
+            t.Errorf("AddressContext failed: %s", err)
+        }
+    }
+}
+
+func TestReplies(t *testing.T) {
+    c, err := getdns.CreateContext(true)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+
+    res, err := c.Address("www.lunch.org.uk", nil)
+    if res == nil {
+        t.Fatalf("No Result created: %s", err)
+    }
+
+    replies, err := res.Replies()
+    if err != nil {
+        t.Fatalf("No Replies: %s", err)
+    }
+    if len(replies) == 0 {
+        t.Fatal("Replies empty")
+    }
+    r := replies[0]
+    if r.Question.Name != "www.lunch.org.uk." {
+        t.Errorf("QNAME incorrect: %s", r.Question.Name)
+    }
+    if !r.Header.QR || r.Header.ANCount != len(r.Answer) {
+        t.Errorf("Bad header: %+v", r.Header)
+    }
+    if r.DNSSECStatus != getdns.DNSSEC_NOT_PERFORMED {
+        t.Errorf("Unexpected DNSSEC status: %d", r.DNSSECStatus)
+    }
+}
+
+func TestReplyFromDict(t *testing.T) {
+    qname, _ := getdns.ConvertFQDNToDNSName("example.com.")
+    d := getdns.Dict{
+        "header": getdns.Dict{
+            "id": 1234, "qr": 1, "opcode": 0, "aa": 0, "tc": 0, "rd": 1,
+            "ra": 1, "z": 0, "ad": 1, "cd": 0, "rcode": 0,
+            "qdcount": 1, "ancount": 1, "nscount": 0, "arcount": 0,
+        },
+        "question": getdns.Dict{
+            "qname": qname, "qtype": getdns.RRTYPE_A, "qclass": 1,
+        },
+        "answer": getdns.List{
+            getdns.Dict{
+                "name": qname, "type": getdns.RRTYPE_A, "class": 1, "ttl": 300,
+                "rdata": getdns.Dict{
+                    "ipv4_address": []byte{192, 0, 2, 1},
+                    "rdata_raw":    []byte{192, 0, 2, 1},
+                },
+            },
+        },
+        "dnssec_status": int(getdns.DNSSEC_SECURE),
+        "bad_dns":       getdns.List{getdns.BAD_DNS_ALL_NUMERIC_LABEL, 1003},
+    }
+
+    r, err := getdns.ReplyFromDict(d)
+    if err != nil {
+        t.Fatalf("ReplyFromDict failed: %s", err)
+    }
+    if r.Header.ID != 1234 || !r.Header.RD || !r.Header.AD || r.Header.CD {
+        t.Errorf("Bad header: %+v", r.Header)
+    }
+    if r.Question.Name != "example.com." || r.Question.Type != getdns.RRTYPE_A {
+        t.Errorf("Bad question: %+v", r.Question)
+    }
+    if len(r.Answer) != 1 || r.Answer[0].TTL != 300 || r.Answer[0].Name != "example.com." {
+        t.Errorf("Bad answer: %+v", r.Answer)
+    }
+    if len(r.Authority) != 0 || len(r.Additional) != 0 {
+        t.Error("Unexpected authority or additional records")
+    }
+    if r.DNSSECStatus != getdns.DNSSEC_SECURE {
+        t.Errorf("Bad DNSSEC status: %d", r.DNSSECStatus)
+    }
+    if len(r.BadDNS) != 2 || r.BadDNS[0].String() != "BAD_DNS_ALL_NUMERIC_LABEL" || r.BadDNS[1] != 1003 {
+        t.Errorf("Bad bad DNS codes: %v", r.BadDNS)
+    }
+
+    delete(d, "question")
+    _, err = getdns.ReplyFromDict(d)
+    gderr, ok := err.(getdns.Error)
+    if !ok || gderr.ReturnCode() != getdns.RETURN_NO_SUCH_DICT_NAME {
+        t.Errorf("Missing question not detected: %v", err)
+    }
+}
+
+func TestDecodeRdata(t *testing.T) {
+    exchange, _ := getdns.ConvertFQDNToDNSName("mail.example.com.")
+    rd, err := getdns.DecodeRdata(getdns.RRTYPE_MX, getdns.Dict{
+        "preference": 10,
+        "exchange":   exchange,
+    })
+    mx, ok := rd.(*getdns.RdataMX)
+    if err != nil || !ok {
+        t.Fatalf("MX not decoded: %v", err)
+    }
+    if mx.Preference != 10 || mx.Exchange != "mail.example.com." {
+        t.Errorf("Bad MX: %+v", mx)
+    }
+
+    rd, err = getdns.DecodeRdata(getdns.RRTYPE_TXT, getdns.Dict{
+        "txt_strings": getdns.List{[]byte("v=spf1"), []byte("-all")},
+    })
+    txt, ok := rd.(*getdns.RdataTXT)
+    if err != nil || !ok || len(txt.Strings) != 2 || txt.Strings[1] != "-all" {
+        t.Errorf("Bad TXT: %v %+v", err, rd)
+    }
+
+    // A, MX, RRSIG, NSEC, TYPE1234.
+    bitmap := []byte{0x00, 0x06, 0x40, 0x01, 0x00, 0x00, 0x00, 0x03, 0x04, 0x1b}
+    bitmap = append(bitmap, make([]byte, 26)...)
+    bitmap = append(bitmap, 0x20)
+    next, _ := getdns.ConvertFQDNToDNSName("b.example.com.")
+    rd, err = getdns.DecodeRdata(getdns.RRTYPE_NSEC, getdns.Dict{
+        "next_domain_name": next,
+        "type_bit_maps":    bitmap,
+    })
+    nsec, ok := rd.(*getdns.RdataNSEC)
+    if err != nil || !ok {
+        t.Fatalf("NSEC not decoded: %v", err)
+    }
+    want := []uint16{getdns.RRTYPE_A, getdns.RRTYPE_MX, getdns.RRTYPE_RRSIG, getdns.RRTYPE_NSEC, 1234}
+    if len(nsec.Types) != len(want) {
+        t.Fatalf("Bad NSEC types: %v", nsec.Types)
+    }
+    for i, typ := range want {
+        if nsec.Types[i] != typ {
+            t.Errorf("Bad NSEC types: %v", nsec.Types)
+        }
+    }
+
+    key, _ := base64.StdEncoding.DecodeString("AwEAAaz/tAm8yTn4Mfeh5eyI96WSVexTBAvkMgJzkKTOiW1vkIbzxeF3+/4RgWOq7HrxRixHlFlExOLAJr5emLvN7SWXgnLh4+B5xQlNVz8Og8kvArMtNROxVQuCaSnIDdD5LKyWbRd2n9WGe2R8PzgCmr3EgVLrjyBxWezF0jLHwVN8efS3rCj/EWgvIWgb9tarpVUDK/b58Da+sqqls3eNbuv7pr+eoZG+SrDK6nWeL3c6H5Apxz7LjVc1uTIdsIXxuOLYA4/ilBmSVIzuDWfdRUfhHdY6+cn8HFRm+2hM8AnXGXws9555KrUB5qihylGa8subX2Nn6UwNR1AkUTV74bU=")
+    rd, err = getdns.DecodeRdata(getdns.RRTYPE_DNSKEY, getdns.Dict{
+        "flags":      257,
+        "protocol":   3,
+        "algorithm":  8,
+        "public_key": key,
+    })
+    dnskey, ok := rd.(*getdns.RdataDNSKEY)
+    if err != nil || !ok {
+        t.Fatalf("DNSKEY not decoded: %v", err)
+    }
+    if dnskey.KeyTag() != 20326 {
+        t.Errorf("Bad DNSKEY key tag: %d", dnskey.KeyTag())
+    }
+
+    rd, err = getdns.DecodeRdata(getdns.RRTYPE_HINFO, getdns.Dict{
+        "rdata_raw": []byte{1, 2, 3},
+    })
+    unk, ok := rd.(*getdns.RdataUnknown)
+    if err != nil || !ok || unk.RRType() != getdns.RRTYPE_HINFO || len(unk.Raw) != 3 {
+        t.Errorf("Bad unknown rdata: %v %+v", err, rd)
+    }
+}
+
+func TestWireConversion(t *testing.T) {
+    wire := []byte{
+        0x12, 0x34, 0x81, 0x80, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+        0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x03, 'c', 'o', 'm', 0x00,
+        0x00, 0x01, 0x00, 0x01,
+        0xc0, 0x0c, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x01, 0x2c,
+        0x00, 0x04, 192, 0, 2, 1,
+    }
+
+    msg, err := getdns.WireToMsgDict(wire)
+    if err != nil {
+        t.Fatalf("WireToMsgDict failed: %s", err)
+    }
+    r, err := getdns.ReplyFromDict(msg)
+    if err != nil {
+        t.Fatalf("ReplyFromDict failed: %s", err)
+    }
+    if r.Header.ID != 0x1234 || r.Question.Name != "example.com." || len(r.Answer) != 1 {
+        t.Fatalf("Bad reply: %+v", r)
+    }
+    rd, err := r.Answer[0].Decode()
+    if a, ok := rd.(*getdns.RdataA); err != nil || !ok || a.Address.String() != "192.0.2.1" {
+        t.Errorf("Bad answer: %v %+v", err, rd)
+    }
+
+    back, err := getdns.MsgDictToWire(msg)
+    if err != nil {
+        t.Fatalf("MsgDictToWire failed: %s", err)
+    }
+    r, err = getdns.ReplyFromWire(back)
+    if err != nil || r.Header.ID != 0x1234 || len(r.Answer) != 1 {
+        t.Errorf("Bad round trip: %v %+v", err, r)
+    }
+
+    answer := msg["answer"].(getdns.List)[0].(getdns.Dict)
+    rrwire, err := getdns.RRDictToWire(answer)
+    if err != nil {
+        t.Fatalf("RRDictToWire failed: %s", err)
+    }
+    rr, err := getdns.WireToRRDict(rrwire)
+    if err != nil {
+        t.Fatalf("WireToRRDict failed: %s", err)
+    }
+    if ttl, _ := rr["ttl"].(int); ttl != 300 {
+        t.Errorf("Bad RR round trip: %v", rr.String())
+    }
+}
+
+func TestTextConversion(t *testing.T) {
+    rr, err := getdns.StringToRRDict("www 300 IN MX 10 mail", "example.com.", 3600)
+    if err != nil {
+        t.Fatalf("StringToRRDict failed: %s", err)
+    }
+    r, err := getdns.RRFromDict(rr)
+    if err != nil {
+        t.Fatalf("RRFromDict failed: %s", err)
+    }
+    if r.Name != "www.example.com." || r.Type != getdns.RRTYPE_MX || r.TTL != 300 {
+        t.Errorf("Bad RR: %+v", r)
+    }
+    rd, err := r.Decode()
+    if mx, ok := rd.(*getdns.RdataMX); err != nil || !ok || mx.Exchange != "mail.example.com." {
+        t.Errorf("Bad MX: %v %+v", err, rd)
+    }
+
+    s, err := getdns.RRDictToString(rr)
+    if err != nil {
+        t.Fatalf("RRDictToString failed: %s", err)
+    }
+    if !strings.HasPrefix(s, "www.example.com.") || !strings.Contains(s, "MX") {
+        t.Errorf("Bad RR string: %s", s)
+    }
+}
+
+func TestReadZone(t *testing.T) {
+    dir := t.TempDir()
+    err := os.WriteFile(filepath.Join(dir, "hosts.zone"), []byte("www A 192.0.2.2\n"), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    zone := `$TTL 1h
+@   IN SOA ns1 hostmaster (
+        2016071601 ; serial
+        3600 900 604800 300 )
+    IN NS ns1
+ns1 300 IN A 192.0.2.1
+$ORIGIN sub.example.com.
+$INCLUDE hosts.zone
+`
+    name := filepath.Join(dir, "example.zone")
+    err = os.WriteFile(name, []byte(zone), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    l, err := getdns.ReadZoneFile(name, "example.com", 0)
+    if err != nil {
+        t.Fatalf("ReadZoneFile failed: %s", err)
+    }
+    rrs, err := getdns.RRsFromList(l)
+    if err != nil {
+        t.Fatalf("RRsFromList failed: %s", err)
+    }
+    want := []struct {
+        name  string
+        rtype uint16
+        ttl   uint32
+    }{
+        {"example.com.", getdns.RRTYPE_SOA, 3600},
+        {"example.com.", getdns.RRTYPE_NS, 3600},
+        {"ns1.example.com.", getdns.RRTYPE_A, 300},
+        {"www.sub.example.com.", getdns.RRTYPE_A, 3600},
+    }
+    if len(rrs) != len(want) {
+        t.Fatalf("Wrong number of records: %d", len(rrs))
+    }
+    for i, w := range want {
+        if rrs[i].Name != w.name || rrs[i].Type != w.rtype || rrs[i].TTL != w.ttl {
+            t.Errorf("Bad record %d: %+v", i, rrs[i])
+        }
+    }
+}
+
+func TestReadZoneErrors(t *testing.T) {
+    zone := "$ORIGIN example.com.\n\n$TTL forever\n"
+    _, err := getdns.ReadZone(strings.NewReader(zone), "", 3600)
+    perr, ok := err.(*getdns.ZoneParseError)
+    if !ok || perr.Line != 3 {
+        t.Errorf("Bad $TTL not reported at line 3: %v", err)
+    }
+
+    zone = "$ORIGIN example.com.\n@ IN SOA ns1 hostmaster (\n 1 2 3 4 5\n"
+    _, err = getdns.ReadZone(strings.NewReader(zone), "", 3600)
+    perr, ok = err.(*getdns.ZoneParseError)
+    if !ok || perr.Line != 2 {
+        t.Errorf("Unbalanced parentheses not reported at line 2: %v", err)
+    }
+
+    zone = "$ORIGIN example.com.\n( )\n"
+    _, err = getdns.ReadZone(strings.NewReader(zone), "", 3600)
+    perr, ok = err.(*getdns.ZoneParseError)
+    if !ok || perr.Line != 2 {
+        t.Errorf("Empty entry not reported at line 2: %v", err)
+    }
+}
+
+func TestValidateDNSSEC(t *testing.T) {
+    c, err := getdns.CreateContext(true)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+
+    exts := getdns.Dict{"dnssec_return_validation_chain": getdns.EXTENSION_TRUE}
+    res, err := c.General("getdnsapi.net", getdns.RRTYPE_A, exts)
+    if res == nil {
+        t.Fatalf("No Result created: %s", err)
+    }
+    chain, err := res.ValidationChain()
+    if err != nil {
+        t.Fatalf("No ValidationChain: %s", err)
+    }
+    rt, err := res.RepliesTree()
+    if err != nil || len(rt) == 0 {
+        t.Fatalf("No RepliesTree: %s", err)
+    }
+    answer, ok := rt[0].(getdns.Dict)["answer"].(getdns.List)
+    if !ok {
+        t.Fatal("No answer")
+    }
+    anchors, err := c.DNSSECTrustAnchors()
+    if err != nil {
+        t.Fatalf("No trust anchors: %s", err)
+    }
+
+    status, err := getdns.ValidateDNSSEC(answer, chain, anchors)
+    if err != nil {
+        t.Fatalf("ValidateDNSSEC failed: %s", err)
+    }
+    if status != getdns.DNSSEC_SECURE {
+        t.Errorf("Answer not secure: %d", status)
+    }
+
+    status, err = getdns.ValidateDNSSECAt(answer, chain, anchors, time.Now().AddDate(1, 0, 0), 0)
+    if err != nil {
+        t.Fatalf("ValidateDNSSECAt failed: %s", err)
+    }
+    if status != getdns.DNSSEC_BOGUS {
+        t.Errorf("Expired answer not bogus: %d", status)
+    }
+}
+
+const rootAnchorsXML = `<?xml version="1.0" encoding="UTF-8"?>
+<TrustAnchor id="380DC50D-484E-40D0-A3AE-68F2B18F61C7" source="http://data.iana.org/root-anchors/root-anchors.xml">
+<Zone>.</Zone>
+<KeyDigest id="Kjqmt7v" validFrom="2010-07-15T00:00:00+00:00" validUntil="2019-01-11T00:00:00+00:00">
+<KeyTag>19036</KeyTag>
+<Algorithm>8</Algorithm>
+<DigestType>2</DigestType>
+<Digest>49AAC11D7B6F6446702E54A1607371607A1A41855200FD2CE1CDDE32F24E8FB5</Digest>
+</KeyDigest>
+<KeyDigest id="Klajeyz" validFrom="2017-02-02T00:00:00+00:00">
+<KeyTag>20326</KeyTag>
+<Algorithm>8</Algorithm>
+<DigestType>2</DigestType>
+<Digest>E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D</Digest>
+</KeyDigest>
+</TrustAnchor>
+`
+
+func TestReadRootAnchorsXML(t *testing.T) {
+    anchors, err := getdns.ReadRootAnchorsXML(strings.NewReader(rootAnchorsXML), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+    if err != nil {
+        t.Fatalf("ReadRootAnchorsXML failed: %s", err)
+    }
+    if len(anchors) != 1 {
+        t.Fatalf("Expired anchor not dropped: %v", anchors)
+    }
+    rr, err := getdns.RRFromDict(anchors[0].(getdns.Dict))
+    if err != nil {
+        t.Fatalf("RRFromDict failed: %s", err)
+    }
+    rd, err := rr.Decode()
+    if err != nil {
+        t.Fatalf("Decode failed: %s", err)
+    }
+    ds, ok := rd.(*getdns.RdataDS)
+    if rr.Name != "." || !ok || ds.KeyTag != 20326 || ds.DigestType != getdns.DIGEST_SHA256 {
+        t.Errorf("Bad anchor: %+v %+v", rr, rd)
+    }
+
+    anchors, err = getdns.ReadRootAnchorsXML(strings.NewReader(rootAnchorsXML), time.Date(2012, 1, 1, 0, 0, 0, 0, time.UTC))
+    if err != nil || len(anchors) != 1 {
+        t.Fatalf("Bad anchors in 2012: %v %v", anchors, err)
+    }
+    rr, _ = getdns.RRFromDict(anchors[0].(getdns.Dict))
+    if tag, _ := rr.Rdata["key_tag"].(int); tag != 19036 {
+        t.Errorf("Wrong anchor in 2012: %v", rr.Rdata)
+    }
+
+    var buf bytes.Buffer
+    err = getdns.WriteRootAnchorsXML(&buf, anchors, time.Date(2010, 7, 15, 0, 0, 0, 0, time.UTC))
+    if err != nil {
+        t.Fatalf("WriteRootAnchorsXML failed: %s", err)
+    }
+    back, err := getdns.ReadRootAnchorsXML(&buf, time.Date(2012, 1, 1, 0, 0, 0, 0, time.UTC))
+    if err != nil || len(back) != 1 {
+        t.Fatalf("Written anchors not read back: %v %v", back, err)
+    }
+}
+
+func TestReadBINDTrustAnchors(t *testing.T) {
+    conf := `
+# Root anchors
+trust-anchors {
+    /* KSK-2017 */
+    . initial-key 257 3 8 "AwEAAaz/tAm8yTn4Mfeh5eyI96WSVexTBAvkMgJzkKTOiW1vkIbzxeF3+/4RgWOq7HrxRixHlFlExOLAJr5emLvN7SWXgnLh4+B5xQlNVz8Og8kvArMtNROxVQuCaSnIDdD5LKyWbRd2n9WGe2R8PzgCmr3EgVLrjyBxWezF0jLHwVN8efS3rCj/EWgvIWgb9tarpVUDK/b58Da+sqqls3eNbuv7pr+eoZG+SrDK6nWeL3c6H5Apxz7LjVc1uTIdsIXxuOLYA4/ilBmSVIzuDWfdRUfhHdY6+cn8HFRm+2hM8AnXGXws9555KrUB5qihylGa8subX2Nn6UwNR1AkUTV74bU=";
+    . static-ds 20326 8 2 "E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"; // DS
+};
+`
+    anchors, err := getdns.ReadBINDTrustAnchors(strings.NewReader(conf))
+    if err != nil {
+        t.Fatalf("ReadBINDTrustAnchors failed: %s", err)
+    }
+    if len(anchors) != 2 {
+        t.Fatalf("Wrong number of anchors: %d", len(anchors))
+    }
+    rrs, err := getdns.RRsFromList(anchors)
+    if err != nil {
+        t.Fatalf("RRsFromList failed: %s", err)
+    }
+    rd, err := rrs[0].Decode()
+    if err != nil {
+        t.Fatalf("Decode failed: %s", err)
+    }
+    key, ok := rd.(*getdns.RdataDNSKEY)
+    if !ok || key.KeyTag() != 20326 {
+        t.Errorf("Bad DNSKEY anchor: %+v", rd)
+    }
+    rd, _ = rrs[1].Decode()
+    ds, ok := rd.(*getdns.RdataDS)
+    if !ok || !key.MatchesDS(".", ds) {
+        t.Errorf("DS anchor does not match key: %+v", rd)
+    }
+
+    var buf bytes.Buffer
+    err = getdns.WriteBINDTrustAnchors(&buf, anchors)
+    if err != nil {
+        t.Fatalf("WriteBINDTrustAnchors failed: %s", err)
+    }
+    if !strings.Contains(buf.String(), ". static-ds 20326 8 2 ") {
+        t.Errorf("Bad BIND output: %s", buf.String())
+    }
+    back, err := getdns.ReadBINDTrustAnchors(&buf)
+    if err != nil || len(back) != 2 {
+        t.Fatalf("Written anchors not read back: %v %v", back, err)
+    }
+
+    anchors, err = getdns.ReadBINDTrustAnchors(strings.NewReader(conf + "trusted-keys { ; };\n"))
+    if err != nil || len(anchors) != 2 {
+        t.Errorf("Empty trusted-keys entry not skipped: %v %v", anchors, err)
+    }
+}
+
+func TestLoadDNSSECTrustAnchors(t *testing.T) {
+    c, err := getdns.CreateContext(true)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+
+    dir := t.TempDir()
+    name := filepath.Join(dir, "root.key")
+    err = os.WriteFile(name, []byte(". 172800 IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D\n"), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+    err = c.LoadDNSSECTrustAnchors(name)
+    if err != nil {
+        t.Fatalf("LoadDNSSECTrustAnchors failed: %s", err)
+    }
+    anchors, err := c.DNSSECTrustAnchors()
+    if err != nil || len(anchors) != 1 {
+        t.Fatalf("Trust anchors not installed: %v %v", anchors, err)
+    }
+
+    var buf bytes.Buffer
+    err = getdns.WriteTrustAnchorZone(&buf, anchors)
+    if err != nil {
+        t.Fatalf("WriteTrustAnchorZone failed: %s", err)
+    }
+    back, err := getdns.ReadTrustAnchorZone(&buf, "")
+    if err != nil || len(back) != 1 {
+        t.Fatalf("Written anchors not read back: %v %v", back, err)
+    }
+}
+
+func TestResolver(t *testing.T) {
+    c, err := getdns.CreateContext(true)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+    r := getdns.NewResolver(c)
+    ctx := context.Background()
+
+    addrs, err := r.LookupHost(ctx, "www.lunch.org.uk")
+    if err != nil || len(addrs) == 0 {
+        t.Errorf("LookupHost failed: %v %v", addrs, err)
+    }
+    ips, err := r.LookupNetIP(ctx, "ip4", "getdnsapi.net")
+    if err != nil || len(ips) == 0 || !ips[0].Is4() {
+        t.Errorf("LookupNetIP failed: %v %v", ips, err)
+    }
+    ns, err := r.LookupNS(ctx, "getdnsapi.net")
+    if err != nil || len(ns) == 0 {
+        t.Errorf("LookupNS failed: %v %v", ns, err)
+    }
+    names, err := r.LookupAddr(ctx, "8.8.8.8")
+    if err != nil || len(names) == 0 || names[0] != "dns.google." {
+        t.Errorf("LookupAddr failed: %v %v", names, err)
+    }
+
+    _, err = r.LookupHost(ctx, "nonexistent.invalid")
+    var de *net.DNSError
+    if !errors.As(err, &de) || !de.IsNotFound {
+        t.Errorf("Missing name not reported as not found: %v", err)
+    }
+
+    expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+    defer cancel()
+    _, err = r.LookupIPAddr(expired, "www.lunch.org.uk")
+    if !errors.As(err, &de) || !de.IsTimeout {
+        t.Errorf("Expired lookup not reported as timeout: %v", err)
+    }
+}
+
+func TestDialer(t *testing.T) {
+    c, err := getdns.CreateContext(true)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+
+    l, err := net.Listen("tcp4", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer l.Close()
+    go func() {
+        for {
+            conn, err := l.Accept()
+            if err != nil {
+                return
+            }
+            conn.Close()
+        }
+    }()
+    _, port, _ := net.SplitHostPort(l.Addr().String())
+
+    d := getdns.NewDialer(c)
+    tr := &http.Transport{DialContext: d.DialContext}
+    defer tr.CloseIdleConnections()
+
+    // Any IPv6 attempt is refused, so the IPv4 address must win.
+    conn, err := d.DialContext(context.Background(), "tcp", net.JoinHostPort("localhost", port))
+    if err != nil {
+        t.Fatalf("DialContext failed: %s", err)
+    }
+    if conn.RemoteAddr().(*net.TCPAddr).IP.String() != "127.0.0.1" {
+        t.Errorf("Connected to wrong address: %s", conn.RemoteAddr())
+    }
+    conn.Close()
+
+    d.RequireSecure = true
+    _, err = d.Dial("tcp", net.JoinHostPort("localhost", port))
+    var oe *net.OpError
+    if !errors.As(err, &oe) {
+        t.Errorf("Insecure address not refused: %v", err)
+    }
+}
+
+func newTestCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    tmpl := &x509.Certificate{
+        SerialNumber:          big.NewInt(time.Now().UnixNano()),
+        Subject:               pkix.Name{CommonName: cn},
+        NotBefore:             time.Now().Add(-time.Hour),
+        NotAfter:              time.Now().Add(time.Hour),
+        BasicConstraintsValid: true,
+    }
+    if parent == nil {
+        tmpl.IsCA = true
+        tmpl.KeyUsage = x509.KeyUsageCertSign
+        parent, parentKey = tmpl, key
+    } else {
+        tmpl.DNSNames = []string{cn}
+        tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+    }
+    der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+    cert, err := x509.ParseCertificate(der)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return cert, key
+}
+
+func TestVerifyDANE(t *testing.T) {
+    if getdns.TLSAName(443, "tcp", "www.example.com") != "_443._tcp.www.example.com" {
+        t.Errorf("Bad TLSA name: %s", getdns.TLSAName(443, "tcp", "www.example.com"))
+    }
+
+    ca, caKey := newTestCert(t, "Test CA", nil, nil)
+    leaf, _ := newTestCert(t, "www.example.com", ca, caKey)
+    other, _ := newTestCert(t, "www.example.org", ca, caKey)
+    cs := tls.ConnectionState{ServerName: "www.example.com", PeerCertificates: []*x509.Certificate{leaf, ca}}
+
+    spki := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+    eeTLSA := &getdns.RdataTLSA{CertificateUsage: getdns.DANE_USAGE_DANE_EE, Selector: getdns.DANE_SELECTOR_SPKI, MatchingType: getdns.DANE_MATCHING_SHA256, Data: spki[:]}
+    err := getdns.VerifyDANE([]*getdns.RdataTLSA{eeTLSA}, "", nil)(cs)
+    if err != nil {
+        t.Errorf("DANE-EE match rejected: %s", err)
+    }
+    err = getdns.VerifyDANE([]*getdns.RdataTLSA{eeTLSA}, "", nil)(tls.ConnectionState{PeerCertificates: []*x509.Certificate{other, ca}})
+    if err == nil {
+        t.Error("DANE-EE mismatch accepted")
+    }
+
+    caDigest := sha512.Sum512(ca.Raw)
+    taTLSA := &getdns.RdataTLSA{CertificateUsage: getdns.DANE_USAGE_DANE_TA, Selector: getdns.DANE_SELECTOR_CERT, MatchingType: getdns.DANE_MATCHING_SHA512, Data: caDigest[:]}
+    err = getdns.VerifyDANE([]*getdns.RdataTLSA{taTLSA}, "", nil)(cs)
+    if err != nil {
+        t.Errorf("DANE-TA match rejected: %s", err)
+    }
+    err = getdns.VerifyDANE([]*getdns.RdataTLSA{taTLSA}, "www.example.net", nil)(cs)
+    if err == nil {
+        t.Error("DANE-TA accepted wrong name")
+    }
+
+    roots := x509.NewCertPool()
+    roots.AddCert(ca)
+    pkixTLSA := &getdns.RdataTLSA{CertificateUsage: getdns.DANE_USAGE_PKIX_EE, Selector: getdns.DANE_SELECTOR_CERT, MatchingType: getdns.DANE_MATCHING_FULL, Data: leaf.Raw}
+    err = getdns.VerifyDANE([]*getdns.RdataTLSA{pkixTLSA}, "", roots)(cs)
+    if err != nil {
+        t.Errorf("PKIX-EE match rejected: %s", err)
+    }
+    err = getdns.VerifyDANE([]*getdns.RdataTLSA{pkixTLSA}, "", nil)(cs)
+    if err == nil {
+        t.Error("PKIX-EE accepted without PKIX validation")
+    }
+
+    unusable := &getdns.RdataTLSA{CertificateUsage: 4, Data: spki[:]}
+    err = getdns.VerifyDANE([]*getdns.RdataTLSA{unusable}, "", roots)(cs)
+    if err != nil {
+        t.Errorf("No fallback to PKIX with unusable records: %s", err)
+    }
+}
+
+func TestMTASTSPolicy(t *testing.T) {
+    policy := "version: STSv1\r\nmode: enforce\r\nmx: mail.example.com\r\nmx: *.example.net\r\nmax_age: 604800\r\n"
+    sts, err := getdns.ParseMTASTSPolicy(strings.NewReader(policy))
+    if err != nil {
+        t.Fatalf("ParseMTASTSPolicy failed: %s", err)
+    }
+    if sts.Mode != getdns.MTASTS_MODE_ENFORCE || sts.MaxAge != 7*24*time.Hour || len(sts.MX) != 2 {
+        t.Errorf("Bad policy: %+v", sts)
+    }
+    for host, want := range map[string]bool{
+        "mail.example.com.":     true,
+        "MX1.example.net":       true,
+        "example.net":           false,
+        "a.mx1.example.net":     false,
+        "mail.example.com.evil": false,
+    } {
+        if sts.Matches(host) != want {
+            t.Errorf("Matches(%s) is not %v", host, want)
+        }
+    }
+
+    _, err = getdns.ParseMTASTSPolicy(strings.NewReader("version: STSv1\nmode: enforce\nmx: mail.example.com\n"))
+    if err == nil {
+        t.Error("Policy without max_age accepted")
+    }
+    if getdns.MAIL_SECURITY_DANE.String() != "dane" {
+        t.Errorf("Bad mail security string: %s", getdns.MAIL_SECURITY_DANE)
+    }
+}
+
+func TestSRVTargets(t *testing.T) {
+    c, err := getdns.CreateContext(true)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+
+    targets, err := c.LookupSRVTargets(context.Background(), "_xmpp-server._tcp.jabber.org")
+    if err != nil {
+        t.Fatalf("LookupSRVTargets failed: %s", err)
+    }
+    if len(targets) == 0 {
+        t.Fatal("No SRV targets")
+    }
+    n := len(targets)
+    var prev uint16
+    for i := 0; i < n; i++ {
+        target, ok := targets.Next()
+        if !ok {
+            t.Fatalf("Next stopped after %d targets", i)
+        }
+        if target.Priority < prev {
+            t.Errorf("Target %s out of priority order", target.Target)
+        }
+        prev = target.Priority
+        if len(target.Addresses) == 0 {
+            t.Errorf("Target %s has no addresses", target.Target)
+        }
+    }
+    if _, ok := targets.Next(); ok {
+        t.Error("Next returned too many targets")
+    }
+}
+
+func TestDecodeServiceTXT(t *testing.T) {
+    attrs := getdns.DecodeServiceTXT([]string{"txtvers=1", "Path=/index.html", "path=/other", "secure", "note=", "=bad"})
+    if len(attrs) != 4 {
+        t.Fatalf("Wrong number of attributes: %v", attrs)
+    }
+    if string(attrs["path"]) != "/index.html" || string(attrs["txtvers"]) != "1" {
+        t.Errorf("Bad attribute values: %v", attrs)
+    }
+    if v, ok := attrs["secure"]; !ok || v != nil {
+        t.Errorf("Bad boolean attribute: %v", attrs)
+    }
+    if v, ok := attrs["note"]; !ok || v == nil || len(v) != 0 {
+        t.Errorf("Bad empty attribute: %v", attrs)
+    }
+}
+
+func TestBrowse(t *testing.T) {
+    c, err := getdns.CreateContext(true)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+
+    instances, err := c.Browse("_http._tcp", "dns-sd.org")
+    if err != nil {
+        t.Fatalf("Browse failed: %s", err)
+    }
+    if len(instances) == 0 {
+        t.Fatal("No service instances")
+    }
+    for _, inst := range instances {
+        if inst.Err != nil {
+            continue
+        }
+        if inst.Service != "_http._tcp" || inst.Domain != "dns-sd.org." || inst.Instance == "" {
+            t.Errorf("Bad instance: %+v", inst)
+        }
+        if len(inst.Targets) == 0 {
+            t.Errorf("Instance %s has no targets", inst.Instance)
+        }
+    }
+}
+
+func TestExtensions(t *testing.T) {
+    doBit := true
+    exts := &getdns.Extensions{
+        DNSSECReturnStatus: true,
+        SpecifyClass:       3,
+        AddOptParameters: &getdns.OptParameters{
+            DoBit:   &doBit,
+            Options: []getdns.EDNSOption{{Code: 10, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}}},
+        },
+    }
+    d := exts.Dict()
+    if d["dnssec_return_status"] != getdns.EXTENSION_TRUE || d["specify_class"] != 3 {
+        t.Errorf("Bad extensions dict: %v", d)
+    }
+    if _, ok := d["return_both_v4_and_v6"]; ok {
+        t.Errorf("Unset extension in dict: %v", d)
+    }
+    opt, ok := d["add_opt_parameters"].(getdns.Dict)
+    if !ok || opt["do_bit"] != 1 {
+        t.Fatalf("Bad OPT parameters: %v", d)
+    }
+    if options, ok := opt["options"].(getdns.List); !ok || len(options) != 1 {
+        t.Errorf("Bad OPT options: %v", opt)
+    }
+    if _, ok := opt["version"]; ok {
+        t.Errorf("Unset OPT version in dict: %v", opt)
+    }
+
+    exts = &getdns.Extensions{
+        AddOptParameters: &getdns.OptParameters{
+            Options: []getdns.EDNSOption{{Code: 12, Data: make([]byte, 8)}},
+        },
+    }
+    opt = exts.Dict()["add_opt_parameters"].(getdns.Dict)
+    for _, key := range []string{"do_bit", "extended_rcode", "version", "maximum_udp_payload_size"} {
+        if _, ok := opt[key]; ok {
+            t.Errorf("Options-only OPT parameters set %s: %v", key, opt)
+        }
+    }
+
+    c, err := getdns.CreateContext(true)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+
+    res, err := c.Address("getdnsapi.net", &getdns.Extensions{DNSSECReturnStatus: true, ReturnBothV4AndV6: true})
+    if res == nil {
+        t.Fatalf("No Result created: %s", err)
+    }
+    replies, err := res.Replies()
+    if err != nil || len(replies) == 0 {
+        t.Fatalf("No replies: %v", err)
+    }
+    if replies[0].DNSSECStatus != getdns.DNSSEC_SECURE {
+        t.Errorf("Reply not secure: %s", replies[0].DNSSECStatus)
+    }
+}
+
+func TestExtensionSupport(t *testing.T) {
+    exts := &getdns.Extensions{
+        DNSSECReturnFullValidationChain: true,
+        DNSSECRoadblockAvoidance:        true,
+        EDNSCookies:                     true,
+        Header:                          &getdns.Header{RD: true, CD: true},
+    }
+    d := exts.Dict()
+    for _, key := range []string{"dnssec_return_full_validation_chain", "dnssec_roadblock_avoidance", "edns_cookies"} {
+        if d[key] != getdns.EXTENSION_TRUE {
+            t.Errorf("Extension %s not set: %v", key, d)
+        }
+    }
+    hd, ok := d["header"].(getdns.Dict)
+    if !ok || hd["rd"] != 1 || hd["cd"] != 1 || hd["aa"] != 0 {
+        t.Errorf("Bad header extension: %v", d)
+    }
+    if _, ok := hd["id"]; ok {
+        t.Errorf("Zero header ID set: %v", hd)
+    }
+
+    c, err := getdns.CreateContext(true)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+
+    _, err = c.Address("getdnsapi.net", getdns.Dict{"no_such_extension": getdns.EXTENSION_TRUE})
+    if err == nil {
+        t.Errorf("Unknown extension accepted")
+    }
+    _, err = c.Address("getdnsapi.net", getdns.Dict{"header": getdns.Dict{"flags": 1}})
+    if err == nil {
+        t.Errorf("Bad header extension accepted")
+    }
+
+    res, err := c.Address("getdnsapi.net", &getdns.Extensions{ReturnCallReporting: true})
+    if res == nil {
+        t.Fatalf("No Result created: %s", err)
+    }
+    reports, err := res.CallReporting()
+    if err != nil {
+        t.Fatalf("CallReporting failed: %s", err)
+    }
+    if len(reports) == 0 || reports[0].QueryName == "" {
+        t.Errorf("Bad call reporting: %v", reports)
+    }
+}
+
+func TestEDNSOptions(t *testing.T) {
+    opts := []getdns.EDNSOptionData{
+        &getdns.EDNSClientSubnet{Prefix: netip.MustParsePrefix("192.0.2.0/24")},
+        &getdns.EDNSClientSubnet{Prefix: netip.MustParsePrefix("2001:db8::/56"), ScopePrefixLen: 48},
+        &getdns.EDNSPadding{Length: 12},
+        &getdns.EDNSCookie{Client: []byte("12345678"), Server: []byte("abcdefgh")},
+        &getdns.EDNSTCPKeepalive{HasTimeout: true, Timeout: 3 * time.Second},
+        &getdns.EDNSNSID{ID: []byte("ns1")},
+        &getdns.EDNSExtendedError{InfoCode: getdns.EDE_DNSSEC_BOGUS, ExtraText: "bad sig"},
+    }
+    for _, o := range opts {
+        enc, err := getdns.EncodeEDNSOption(o)
+        if err != nil {
+            t.Fatalf("EncodeEDNSOption %T failed: %s", o, err)
+        }
+        dec, err := enc.Decode()
+        if err != nil {
+            t.Fatalf("Decode %T failed: %s", o, err)
+        }
+        if !reflect.DeepEqual(dec, o) {
+            t.Errorf("Option round trip: got %+v, want %+v", dec, o)
+        }
+    }
+
+    enc, _ := getdns.EncodeEDNSOption(&getdns.EDNSClientSubnet{Prefix: netip.MustParsePrefix("198.51.100.77/20")})
+    if !bytes.Equal(enc.Data, []byte{0, 1, 20, 0, 198, 51, 96}) {
+        t.Errorf("Bad ECS encoding: %v", enc.Data)
+    }
+    enc, _ = getdns.EncodeEDNSOption(&getdns.EDNSClientSubnet{Prefix: netip.MustParsePrefix("::ffff:192.0.2.0/120")})
+    if !bytes.Equal(enc.Data, []byte{0, 1, 24, 0, 192, 0, 2}) {
+        t.Errorf("Bad IPv4-mapped ECS encoding: %v", enc.Data)
+    }
+    if _, err := getdns.EncodeEDNSOption(&getdns.EDNSClientSubnet{Prefix: netip.MustParsePrefix("::ffff:0:0/64")}); err == nil {
+        t.Error("IPv4-mapped ECS prefix shorter than 96 bits accepted")
+    }
+    if _, err := getdns.EncodeEDNSOption(&getdns.EDNSCookie{Client: []byte("short")}); err == nil {
+        t.Error("Short client cookie accepted")
+    }
+    if getdns.EDE_STALE_ANSWER.String() != "Stale Answer" {
+        t.Errorf("Bad EDE name: %s", getdns.EDE_STALE_ANSWER)
+    }
+
+    root, _ := getdns.ConvertFQDNToDNSName(".")
+    ede, _ := getdns.EncodeEDNSOption(&getdns.EDNSExtendedError{InfoCode: getdns.EDE_STALE_ANSWER})
+    rr, err := getdns.RRFromDict(getdns.Dict{
+        "name": root, "type": getdns.RRTYPE_OPT,
+        "udp_payload_size": 1232, "extended_rcode": 0, "version": 0, "do": 1, "z": 0,
+        "rdata": getdns.Dict{
+            "options": getdns.List{
+                getdns.Dict{"option_code": getdns.EDNS_OPTION_NSID, "option_data": []byte("ns1")},
+                getdns.Dict{"option_code": int(ede.Code), "option_data": ede.Data},
+            },
+        },
+    })
+    if err != nil {
+        t.Fatalf("RRFromDict failed: %s", err)
+    }
+    r := &getdns.Reply{Additional: []getdns.RR{rr}}
+    opt, err := r.OPT()
+    if err != nil || opt == nil {
+        t.Fatalf("No OPT record: %v", err)
+    }
+    if opt.UDPPayloadSize != 1232 || !opt.DoBit || len(opt.Options) != 2 {
+        t.Errorf("Bad OPT record: %+v", opt)
+    }
+    nsid, err := opt.Option(getdns.EDNS_OPTION_NSID)
+    if err != nil || string(nsid.(*getdns.EDNSNSID).ID) != "ns1" {
+        t.Errorf("Bad NSID: %v %v", nsid, err)
+    }
+    e, err := opt.Option(getdns.EDNS_OPTION_EDE)
+    if err != nil || e.(*getdns.EDNSExtendedError).InfoCode != getdns.EDE_STALE_ANSWER {
+        t.Errorf("Bad EDE: %v %v", e, err)
+    }
+}
+
+func TestResponseError(t *testing.T) {
+    var err error = &getdns.ResponseError{
+        Status: getdns.RESPSTATUS_NO_ALL_BOGUS_ANSWERS,
+        Rcode:  2,
+        EDE:    &getdns.EDNSExtendedError{InfoCode: getdns.EDE_DNSSEC_BOGUS, ExtraText: "no valid signature"},
+    }
+    want := "getdns response: all answers bogus, rcode SERVFAIL, EDE 6 (DNSSEC Bogus): no valid signature"
+    if err.Error() != want {
+        t.Errorf("Bad error text: %s", err)
+    }
+    var re *getdns.ResponseError
+    if !errors.As(fmt.Errorf("lookup: %w", err), &re) || re.EDE.InfoCode != getdns.EDE_DNSSEC_BOGUS {
+        t.Errorf("errors.As failed for %v", err)
+    }
+
+    c, err := getdns.CreateContext(true)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+
+    res, err := c.Address("getdnsapi.net", nil)
+    if res == nil {
+        t.Fatalf("No Result created: %s", err)
+    }
+    if err := res.Err(); err != nil {
+        t.Errorf("Unexpected error for good lookup: %s", err)
+    }
+    res, err = c.Address("no-such-name.getdnsapi.net", nil)
+    if res == nil {
+        t.Fatalf("No Result created: %s", err)
+    }
+    if !errors.As(res.Err(), &re) || re.Status != getdns.RESPSTATUS_NO_NAME || re.Rcode != 3 {
+        t.Errorf("Bad error for missing name: %v", res.Err())
+    }
+}
+
+func TestErrors(t *testing.T) {
+    _, err := getdns.ConvertDNSNameToFQDN([]byte{5, 'a'})
+    if !errors.Is(err, getdns.ErrBadDomainName) || errors.Is(err, getdns.ErrInvalidParameter) {
+        t.Errorf("errors.Is failed for %v", err)
+    }
+
+    var re error = &getdns.ResponseError{Status: getdns.RESPSTATUS_ALL_TIMEOUT}
+    var te *getdns.AllTimeoutError
+    if !errors.As(re, &te) || !te.Timeout() {
+        t.Errorf("No AllTimeoutError in %v", re)
+    }
+    var nne *getdns.NoNameError
+    if errors.As(re, &nne) {
+        t.Errorf("Unexpected NoNameError in %v", re)
+    }
+    var abe *getdns.AllBogusError
+    if !errors.As(&getdns.ResponseError{Status: getdns.RESPSTATUS_NO_ALL_BOGUS_ANSWERS}, &abe) {
+        t.Error("No AllBogusError")
+    }
+
+    c, err := getdns.CreateContext(true)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+
+    _, err = c.General("getdnsapi.net", getdns.RRTYPE_A, getdns.Dict{"no_such_extension": getdns.EXTENSION_TRUE})
+    var oe *getdns.OpError
+    if !errors.As(err, &oe) || oe.Op != "general" || oe.Name != "getdnsapi.net" {
+        t.Fatalf("No OpError: %v", err)
+    }
+    if !errors.Is(err, getdns.ErrNoSuchExtension) || oe.ReturnCode() != getdns.RETURN_NO_SUCH_EXTENSION {
+        t.Errorf("Bad OpError: %v", err)
+    }
+    if gderr, ok := err.(getdns.Error); !ok || gderr.ReturnCode() != getdns.RETURN_NO_SUCH_EXTENSION {
+        t.Errorf("OpError is not a getdns.Error: %v", err)
+    }
+}
+
+func TestNegativeTrustAnchors(t *testing.T) {
+    c, err := getdns.CreateContext(true)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+
+    err = c.SetNegativeTrustAnchors([]getdns.NegativeTrustAnchor{
+        {Zone: "dnssec-failed.org", Expires: time.Now().Add(time.Hour)},
+        {Zone: "example.net", Expires: time.Now().Add(-time.Second)},
+    })
+    if err != nil {
+        t.Fatalf("SetNegativeTrustAnchors failed: %s", err)
+    }
+    err = c.AddNegativeTrustAnchor("example.com", time.Now().Add(-time.Second))
+    if err != nil {
+        t.Fatalf("AddNegativeTrustAnchor failed: %s", err)
+    }
+    ntas := c.NegativeTrustAnchors()
+    if len(ntas) != 1 || ntas[0].Zone != "dnssec-failed.org." {
+        t.Fatalf("Bad negative trust anchors: %v", ntas)
+    }
+
+    exts := getdns.Dict{"dnssec_return_status": getdns.EXTENSION_TRUE}
+    res, err := c.General("www.dnssec-failed.org", getdns.RRTYPE_A, exts)
+    if res == nil {
+        t.Fatalf("No Result created: %s", err)
+    }
+    status, err := res.Status()
+    if err != nil || status != getdns.RESPSTATUS_GOOD {
+        t.Fatalf("Bad status %d: %v", status, err)
+    }
+    replies, err := res.Replies()
+    if err != nil || len(replies) == 0 {
+        t.Fatalf("No replies: %v", err)
+    }
+    for _, r := range replies {
+        if r.DNSSECStatus != getdns.DNSSEC_INSECURE {
+            t.Errorf("Reply under negative trust anchor is %s", r.DNSSECStatus)
+        }
+    }
+}
+
+// testKey is an ECDSA P-256 (algorithm 13) root zone key.
+type testKey struct {
+    priv  *ecdsa.PrivateKey
+    flags uint16
+}
+
+func newTestKey(t *testing.T) *testKey {
+    priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return &testKey{priv: priv, flags: getdns.DNSKEY_FLAG_ZONE | getdns.DNSKEY_FLAG_SEP}
+}
+
+func (k *testKey) dnskey() *getdns.RdataDNSKEY {
+    pub := k.priv.PublicKey.X.FillBytes(make([]byte, 32))
+    pub = append(pub, k.priv.PublicKey.Y.FillBytes(make([]byte, 32))...)
+    return &getdns.RdataDNSKEY{Flags: k.flags, Protocol: 3, Algorithm: 13, PublicKey: pub}
+}
+
+func (k *testKey) rdata() []byte {
+    key := k.dnskey()
+    return append([]byte{byte(key.Flags >> 8), byte(key.Flags), key.Protocol, key.Algorithm}, key.PublicKey...)
+}
+
+func rootRR(rrtype uint16, rdata []byte) []byte {
+    rr := []byte{0, byte(rrtype >> 8), byte(rrtype), 0, 1, 0, 0, 0x0e, 0x10, byte(len(rdata) >> 8), byte(len(rdata))}
+    return append(rr, rdata...)
+}
+
+// rollingZone is a stand-in root server answering every query with
+// its current signed DNSKEY RRset.
+type rollingZone struct {
+    conn net.PacketConn
+    mu   sync.Mutex
+    rrs  [][]byte
+}
+
+// sign sets the DNSKEY RRset to keys, signed by signers with
+// signatures valid around now.
+func (z *rollingZone) sign(t *testing.T, now time.Time, keys []*testKey, signers ...*testKey) {
+    var rdatas [][]byte
+    for _, k := range keys {
+        rdatas = append(rdatas, k.rdata())
+    }
+    sort.Slice(rdatas, func(i, j int) bool { return bytes.Compare(rdatas[i], rdatas[j]) < 0 })
+    var rrs [][]byte
+    var signed []byte
+    for _, rd := range rdatas {
+        rr := rootRR(getdns.RRTYPE_DNSKEY, rd)
+        rrs = append(rrs, rr)
+        signed = append(signed, rr...)
+    }
+
+    for _, k := range signers {
+        hdr := make([]byte, 19)
+        binary.BigEndian.PutUint16(hdr, getdns.RRTYPE_DNSKEY)
+        hdr[2] = 13
+        binary.BigEndian.PutUint32(hdr[4:], 3600)
+        binary.BigEndian.PutUint32(hdr[8:], uint32(now.Add(10*24*time.Hour).Unix()))
+        binary.BigEndian.PutUint32(hdr[12:], uint32(now.Add(-time.Hour).Unix()))
+        binary.BigEndian.PutUint16(hdr[16:], k.dnskey().KeyTag())
+        sum := sha256.Sum256(append(append([]byte{}, hdr...), signed...))
+        r, s, err := ecdsa.Sign(rand.Reader, k.priv, sum[:])
+        if err != nil {
+            t.Fatal(err)
+        }
+        sig := append(hdr, r.FillBytes(make([]byte, 32))...)
+        sig = append(sig, s.FillBytes(make([]byte, 32))...)
+        rrs = append(rrs, rootRR(getdns.RRTYPE_RRSIG, sig))
+    }
+
+    z.mu.Lock()
+    z.rrs = rrs
+    z.mu.Unlock()
+}
+
+func (z *rollingZone) serve() {
+    buf := make([]byte, 512)
+    for {
+        n, addr, err := z.conn.ReadFrom(buf)
+        if err != nil {
+            return
+        }
+        q := buf[:n]
+        end := 12
+        for end < n && q[end] != 0 {
+            end += int(q[end]) + 1
+        }
+        end += 5
+        if end > n {
+            continue
+        }
+
+        z.mu.Lock()
+        rrs := z.rrs
+        z.mu.Unlock()
+        msg := []byte{q[0], q[1], 0x84 | q[2]&0x01, 0, 0, 1, 0, byte(len(rrs)), 0, 0, 0, 1}
+        msg = append(msg, q[12:end]...)
+        for _, rr := range rrs {
+            msg = append(msg, rr...)
+        }
+        // OPT with the DO bit set.
+        msg = append(msg, 0, 0, 41, 0x10, 0, 0, 0, 0x80, 0, 0, 0)
+        z.conn.WriteTo(msg, addr)
+    }
+}
+
+func TestTrustAnchorManager(t *testing.T) {
+    conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer conn.Close()
+    zone := &rollingZone{conn: conn}
+    go zone.serve()
+
+    c, err := getdns.CreateContext(false)
+    if c == nil {
+        t.Fatalf("No Context created: %s", err)
+    }
+    defer c.Destroy()
+    err = c.SetResolutionType(getdns.RESOLUTION_STUB)
+    if err != nil {
+        t.Fatalf("Can't set stub resolution: %s", err)
+    }
+    upstream := getdns.Dict{"address_type": "IPv4", "address_data": "127.0.0.1", "port": conn.LocalAddr().(*net.UDPAddr).Port}
+    err = c.SetUpstreamRecursiveServers(getdns.List{upstream})
+    if err != nil {
+        t.Fatalf("Can't set upstream: %s", err)
+    }
+
+    k1, k2 := newTestKey(t), newTestKey(t)
+    anchor, err := getdns.StringToRRDict(". 3600 IN DNSKEY 257 3 13 "+base64.StdEncoding.EncodeToString(k1.dnskey().PublicKey), "", 3600)
+    if err != nil {
+        t.Fatalf("StringToRRDict failed: %s", err)
+    }
+    state := filepath.Join(t.TempDir(), "root.json")
+    m, err := getdns.NewTrustAnchorManager(c, ".", state, getdns.List{anchor})
+    if err != nil {
+        t.Fatalf("NewTrustAnchorManager failed: %s", err)
+    }
+    now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+    m.Now = func() time.Time { return now }
+
+    refresh := func(m *getdns.TrustAnchorManager, anchors int, want ...getdns.KeyState) {
+        t.Helper()
+        err := m.Refresh(context.Background())
+        if err != nil {
+            t.Fatalf("Refresh failed: %s", err)
+        }
+        keys := m.Keys()
+        if len(keys) != len(want) {
+            t.Fatalf("Wrong number of keys: %+v", keys)
+        }
+        for i, k := range keys {
+            if k.State != want[i] {
+                t.Errorf("Key %d is %s, not %s", k.Key.KeyTag(), k.State, want[i])
+            }
+        }
+        l, err := c.DNSSECTrustAnchors()
+        if err != nil || len(l) != anchors {
+            t.Errorf("Context has %d trust anchors, not %d: %v", len(l), anchors, err)
+        }
+    }
+
+    // A new key is pending until the add hold-down expires.
+    zone.sign(t, now, []*testKey{k1, k2}, k1)
+    err = m.Install()
+    if err != nil {
+        t.Fatalf("Install failed: %s", err)
+    }
+    refresh(m, 1, getdns.KEY_VALID, getdns.KEY_ADDPEND)
+    if !m.NextRefresh().After(now) {
+        t.Errorf("Bad next refresh: %s", m.NextRefresh())
+    }
+    now = now.Add(31 * 24 * time.Hour)
+    zone.sign(t, now, []*testKey{k1, k2}, k1)
+    refresh(m, 2, getdns.KEY_VALID, getdns.KEY_VALID)
+
+    // The old key is revoked.
+    k1.flags |= getdns.DNSKEY_FLAG_REVOKE
+    zone.sign(t, now, []*testKey{k1, k2}, k1, k2)
+    refresh(m, 1, getdns.KEY_REVOKED, getdns.KEY_VALID)
+
+    // State survives a restart, and the revoked key is forgotten after
+    // the remove hold-down.
+    m, err = getdns.NewTrustAnchorManager(c, ".", state, nil)
+    if err != nil {
+        t.Fatalf("NewTrustAnchorManager from state failed: %s", err)
+    }
+    m.Now = func() time.Time { return now }
+    now = now.Add(31 * 24 * time.Hour)
+    zone.sign(t, now, []*testKey{k2}, k2)
+    refresh(m, 1, getdns.KEY_VALID)
+
+    // An RRset not signed by a trusted key is rejected.
+    zone.sign(t, now, []*testKey{k1, k2}, k1)
+    if m.Refresh(context.Background()) == nil {
+        t.Error("Unvalidated DNSKEY RRset accepted")
+    }
+}
+
 func TestAppendName(t *testing.T) {
     c, err := getdns.CreateContext(true)
     if c == nil {
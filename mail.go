@@ -0,0 +1,421 @@
+package getdns
+
+import (
+    "bufio"
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/netip"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// MailSecurity is the transport security required when delivering to
+// an MX host.
+type MailSecurity int
+
+const (
+    // MAIL_SECURITY_NONE allows delivery in plain text, or with
+    // opportunistic unauthenticated TLS.
+    MAIL_SECURITY_NONE MailSecurity = iota
+    // MAIL_SECURITY_MTA_STS requires TLS with a PKIX certificate for
+    // the host (RFC 8461).
+    MAIL_SECURITY_MTA_STS
+    // MAIL_SECURITY_DANE requires TLS authenticated with the host's
+    // TLSA records (RFC 7672).
+    MAIL_SECURITY_DANE
+)
+
+func (s MailSecurity) String() string {
+    switch s {
+    case MAIL_SECURITY_NONE:
+        return "none"
+    case MAIL_SECURITY_MTA_STS:
+        return "mta-sts"
+    case MAIL_SECURITY_DANE:
+        return "dane"
+    default:
+        return fmt.Sprintf("MailSecurity(%d)", int(s))
+    }
+}
+
+// MTA-STS policy modes.
+const (
+    MTASTS_MODE_ENFORCE = "enforce"
+    MTASTS_MODE_TESTING = "testing"
+    MTASTS_MODE_NONE    = "none"
+)
+
+// MTASTSPolicy is a domain's MTA-STS policy (RFC 8461).
+type MTASTSPolicy struct {
+    ID     string
+    Mode   string
+    MX     []string
+    MaxAge time.Duration
+}
+
+// MXHostPolicy is how to deliver to one MX host. If Err is set, the
+// host must not be used.
+type MXHostPolicy struct {
+    Host            string
+    Preference      uint16
+    Addresses       []netip.Addr
+    AddressesSecure bool
+    // TLSA holds the host's usable DANE-TA and DANE-EE records, if
+    // DANE applies.
+    TLSA     []*RdataTLSA
+    Security MailSecurity
+    Err      error
+}
+
+// MailPolicy is the delivery policy for a mail domain.
+type MailPolicy struct {
+    Domain   string
+    MXSecure bool
+    // NullMX is set if the domain accepts no mail (RFC 7505).
+    NullMX bool
+    // MTASTS is the MTA-STS policy, or nil if the domain has none or
+    // it could not be fetched, in which case MTASTSErr says why.
+    MTASTS    *MTASTSPolicy
+    MTASTSErr error
+    // Hosts are in preference order.
+    Hosts []*MXHostPolicy
+}
+
+// MailResolver resolves mail delivery policies using a Context.
+type MailResolver struct {
+    Context *Context
+
+    // HTTPClient fetches MTA-STS policies. If nil,
+    // http.DefaultClient's settings are used. Redirects are never
+    // followed.
+    HTTPClient *http.Client
+}
+
+// NewMailResolver returns a MailResolver that resolves using c.
+func NewMailResolver(c *Context) *MailResolver {
+    return &MailResolver{Context: c}
+}
+
+// ResolveMailPolicy resolves the MX hosts of domain in preference
+// order, with their addresses and TLSA records, and the domain's
+// MTA-STS policy. Each host gets DANE if the MX records, its addresses
+// and its TLSA records are all DNSSEC secure, else MTA-STS if the
+// domain has an enforced policy, else no required security.
+func (r *MailResolver) ResolveMailPolicy(ctx context.Context, domain string) (*MailPolicy, error) {
+    policy := &MailPolicy{Domain: domain}
+
+    rds, secure, err := r.Context.secureLookup(ctx, domain, RRTYPE_MX)
+    if err != nil {
+        return nil, err
+    }
+    policy.MXSecure = secure
+    for _, rd := range rds {
+        mx := rd.(*RdataMX)
+        if mx.Exchange == "." {
+            policy.NullMX = true
+            continue
+        }
+        policy.Hosts = append(policy.Hosts, &MXHostPolicy{Host: mx.Exchange, Preference: mx.Preference})
+    }
+    if policy.NullMX {
+        policy.Hosts = nil
+        return policy, nil
+    }
+    if len(rds) == 0 {
+        // No MX records, so the domain is its own implicit MX.
+        policy.Hosts = []*MXHostPolicy{{Host: canonicalName(domain)}}
+    }
+    sort.SliceStable(policy.Hosts, func(i, j int) bool {
+        return policy.Hosts[i].Preference < policy.Hosts[j].Preference
+    })
+
+    policy.MTASTS, policy.MTASTSErr = r.lookupMTASTS(ctx, domain)
+
+    for _, host := range policy.Hosts {
+        r.resolveHost(ctx, policy, host)
+    }
+    return policy, nil
+}
+
+func (r *MailResolver) resolveHost(ctx context.Context, policy *MailPolicy, host *MXHostPolicy) {
+    host.AddressesSecure = true
+    for _, rrtype := range []uint{RRTYPE_AAAA, RRTYPE_A} {
+        rds, secure, err := r.Context.secureLookup(ctx, host.Host, rrtype)
+        if err != nil {
+            host.Err = err
+            return
+        }
+        host.AddressesSecure = host.AddressesSecure && secure
+        for _, rd := range rds {
+            var ip net.IP
+            switch rd := rd.(type) {
+            case *RdataA:
+                ip = rd.Address
+            case *RdataAAAA:
+                ip = rd.Address
+            }
+            if addr, ok := netip.AddrFromSlice(ip); ok {
+                host.Addresses = append(host.Addresses, addr.Unmap())
+            }
+        }
+    }
+    if len(host.Addresses) == 0 {
+        host.Err = notFoundError(host.Host)
+        return
+    }
+
+    if policy.MXSecure && host.AddressesSecure {
+        name := TLSAName(25, "tcp", host.Host)
+        rds, secure, err := r.Context.secureLookup(ctx, name, RRTYPE_TLSA)
+        if err != nil {
+            // A failed TLSA lookup may hide DANE, so the host is unusable.
+            host.Err = err
+            return
+        }
+        if secure {
+            for _, rd := range rds {
+                tlsa := rd.(*RdataTLSA)
+                // Only DANE-TA and DANE-EE are usable for SMTP.
+                if usableTLSA(tlsa) && tlsa.CertificateUsage >= DANE_USAGE_DANE_TA {
+                    host.TLSA = append(host.TLSA, tlsa)
+                }
+            }
+        }
+        if len(host.TLSA) > 0 {
+            host.Security = MAIL_SECURITY_DANE
+            return
+        }
+    }
+
+    if sts := policy.MTASTS; sts != nil && sts.Mode == MTASTS_MODE_ENFORCE {
+        if !sts.Matches(host.Host) {
+            host.Err = fmt.Errorf("MX host %s not permitted by MTA-STS policy", host.Host)
+            return
+        }
+        host.Security = MAIL_SECURITY_MTA_STS
+    }
+}
+
+// lookupMTASTS looks up the _mta-sts TXT record of domain and, if
+// there is one, fetches the policy.
+func (r *MailResolver) lookupMTASTS(ctx context.Context, domain string) (*MTASTSPolicy, error) {
+    rds, _, err := r.Context.secureLookup(ctx, "_mta-sts."+domain, RRTYPE_TXT)
+    if err != nil {
+        return nil, err
+    }
+    id := ""
+    for _, rd := range rds {
+        txt := strings.Join(rd.(*RdataTXT).Strings, "")
+        if !strings.HasPrefix(txt, "v=STSv1") {
+            continue
+        }
+        for _, field := range strings.Split(txt, ";") {
+            key, val, _ := strings.Cut(strings.TrimSpace(field), "=")
+            if key == "id" {
+                id = val
+            }
+        }
+    }
+    if id == "" {
+        return nil, nil
+    }
+
+    client := &http.Client{}
+    if r.HTTPClient != nil {
+        *client = *r.HTTPClient
+    }
+    client.CheckRedirect = func(*http.Request, []*http.Request) error {
+        return http.ErrUseLastResponse
+    }
+    url := "https://mta-sts." + strings.TrimSuffix(domain, ".") + "/.well-known/mta-sts.txt"
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+    if err != nil {
+        return nil, err
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("MTA-STS policy fetch: %s", resp.Status)
+    }
+    sts, err := ParseMTASTSPolicy(io.LimitReader(resp.Body, 64*1024))
+    if err != nil {
+        return nil, err
+    }
+    sts.ID = id
+    return sts, nil
+}
+
+// ParseMTASTSPolicy parses an MTA-STS policy file.
+func ParseMTASTSPolicy(r io.Reader) (*MTASTSPolicy, error) {
+    sts := &MTASTSPolicy{}
+    version := ""
+    maxAge := false
+    s := bufio.NewScanner(r)
+    for s.Scan() {
+        line := strings.TrimSpace(s.Text())
+        if line == "" {
+            continue
+        }
+        key, val, ok := strings.Cut(line, ":")
+        if !ok {
+            return nil, fmt.Errorf("bad MTA-STS policy line %q", line)
+        }
+        val = strings.TrimSpace(val)
+        switch strings.TrimSpace(key) {
+        case "version":
+            version = val
+        case "mode":
+            sts.Mode = val
+        case "mx":
+            sts.MX = append(sts.MX, val)
+        case "max_age":
+            secs, err := strconv.ParseUint(val, 10, 32)
+            if err != nil {
+                return nil, fmt.Errorf("bad MTA-STS max_age %q", val)
+            }
+            sts.MaxAge = time.Duration(secs) * time.Second
+            maxAge = true
+        }
+    }
+    if err := s.Err(); err != nil {
+        return nil, err
+    }
+
+    if version != "STSv1" {
+        return nil, fmt.Errorf("bad MTA-STS policy version %q", version)
+    }
+    switch sts.Mode {
+    case MTASTS_MODE_ENFORCE, MTASTS_MODE_TESTING, MTASTS_MODE_NONE:
+    default:
+        return nil, fmt.Errorf("bad MTA-STS policy mode %q", sts.Mode)
+    }
+    if !maxAge {
+        return nil, errors.New("MTA-STS policy has no max_age")
+    }
+    if len(sts.MX) == 0 && sts.Mode != MTASTS_MODE_NONE {
+        return nil, errors.New("MTA-STS policy has no mx")
+    }
+    return sts, nil
+}
+
+// Matches reports whether host matches one of the policy's mx
+// patterns. A "*." pattern matches exactly one leftmost label.
+func (p *MTASTSPolicy) Matches(host string) bool {
+    host = strings.ToLower(strings.TrimSuffix(host, "."))
+    for _, pattern := range p.MX {
+        pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+        if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+            label, rest, found := strings.Cut(host, ".")
+            if found && label != "" && rest == suffix {
+                return true
+            }
+        } else if host == pattern {
+            return true
+        }
+    }
+    return false
+}
+
+// secureLookup looks up name with DNSSEC status, returning the decoded
+// answers of type rrtype and whether all replies were secure. A
+// nonexistent name or type gives no answers and no error.
+func (c *Context) secureLookup(ctx context.Context, name string, rrtype uint) ([]Rdata, bool, error) {
+    rrs, status, err := c.lookupStatus(ctx, name, rrtype)
+    if err != nil {
+        return nil, false, err
+    }
+    var rds []Rdata
+    for _, rr := range rrs {
+        rd, err := rr.Decode()
+        if err != nil {
+            return nil, false, dnsError(err, name)
+        }
+        rds = append(rds, rd)
+    }
+    return rds, status == DNSSEC_SECURE, nil
+}
+
+// lookupStatus looks up name with DNSSEC status, returning the answers
+// of type rrtype and the combined status of the replies. A nonexistent
+// name or type gives no answers and no error.
+func (c *Context) lookupStatus(ctx context.Context, name string, rrtype uint) ([]RR, DNSSECStatus, error) {
+    exts := Dict{"dnssec_return_status": EXTENSION_TRUE}
+    res, err := c.GeneralContext(ctx, name, rrtype, exts)
+    if err != nil {
+        return nil, 0, dnsError(err, name)
+    }
+    defer res.Destroy()
+    status, err := res.Status()
+    if err != nil {
+        return nil, 0, dnsError(err, name)
+    }
+    if status != RESPSTATUS_GOOD && status != RESPSTATUS_NO_NAME {
+        return nil, 0, statusError(res, name)
+    }
+    replies, err := res.Replies()
+    if err != nil {
+        return nil, 0, dnsError(err, name)
+    }
+    return answersOfType(replies, uint16(rrtype)), repliesStatus(replies), nil
+}
+
+func answersOfType(replies []*Reply, rrtype uint16) []RR {
+    var res []RR
+    for _, reply := range replies {
+        for _, rr := range reply.Answer {
+            if rr.Type == rrtype {
+                res = append(res, rr)
+            }
+        }
+    }
+    return res
+}
+
+// repliesStatus returns DNSSEC_SECURE if all replies are secure, and
+// otherwise the least secure reply status.
+func repliesStatus(replies []*Reply) DNSSECStatus {
+    if len(replies) == 0 {
+        return DNSSEC_INDETERMINATE
+    }
+    res := DNSSEC_SECURE
+    for _, reply := range replies {
+        res = combineDNSSECStatus(res, reply.DNSSECStatus)
+    }
+    return res
+}
+
+// dnssecStatusRank orders statuses from most to least secure. Unknown
+// statuses rank below all others, so they are never taken as secure.
+func dnssecStatusRank(s DNSSECStatus) int {
+    switch s {
+    case DNSSEC_SECURE:
+        return 0
+    case DNSSEC_NOT_PERFORMED:
+        return 1
+    case DNSSEC_INSECURE:
+        return 2
+    case DNSSEC_INDETERMINATE:
+        return 3
+    case DNSSEC_BOGUS:
+        return 4
+    default:
+        return 5
+    }
+}
+
+// combineDNSSECStatus returns the less secure of a and b.
+func combineDNSSECStatus(a, b DNSSECStatus) DNSSECStatus {
+    if dnssecStatusRank(b) > dnssecStatusRank(a) {
+        return b
+    }
+    return a
+}
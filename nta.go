@@ -0,0 +1,155 @@
+package getdns
+
+// #include <getdns/getdns_extra.h>
+import "C"
+
+import (
+    "time"
+)
+
+var cDNSSEC_STATUS = C.CString("dnssec_status")
+var cSTATUS = C.CString("status")
+
+// NegativeTrustAnchor disables DNSSEC validation for a zone and the
+// names below it until Expires (RFC 7646). A zero Expires never
+// expires.
+type NegativeTrustAnchor struct {
+    Zone    string
+    Expires time.Time
+}
+
+// SetNegativeTrustAnchors replaces the Context negative trust anchors
+// with ntas. Anchors that have already expired are dropped.
+//
+// libgetdns has no negative trust anchors, so they are applied to
+// results: lookups for names under a negative trust anchor that
+// request DNSSEC status also ask for bogus replies, and bogus replies
+// are reported as insecure. Lookups with dnssec_return_only_secure and
+// Hostname lookups are not affected.
+func (c *Context) SetNegativeTrustAnchors(ntas []NegativeTrustAnchor) error {
+    res := make([]NegativeTrustAnchor, len(ntas))
+    for i, nta := range ntas {
+        _, err := ConvertFQDNToDNSName(nta.Zone)
+        if err != nil {
+            return err
+        }
+        res[i] = NegativeTrustAnchor{Zone: canonicalName(nta.Zone), Expires: nta.Expires}
+    }
+
+    c.ntaMu.Lock()
+    c.ntas = res
+    c.expireNegativeTrustAnchors()
+    c.ntaMu.Unlock()
+    return nil
+}
+
+// AddNegativeTrustAnchor adds a negative trust anchor for zone,
+// replacing any existing one for the zone.
+func (c *Context) AddNegativeTrustAnchor(zone string, expires time.Time) error {
+    _, err := ConvertFQDNToDNSName(zone)
+    if err != nil {
+        return err
+    }
+    zone = canonicalName(zone)
+
+    c.ntaMu.Lock()
+    defer c.ntaMu.Unlock()
+    for i := range c.ntas {
+        if c.ntas[i].Zone == zone {
+            c.ntas[i].Expires = expires
+            return nil
+        }
+    }
+    c.ntas = append(c.ntas, NegativeTrustAnchor{Zone: zone, Expires: expires})
+    return nil
+}
+
+// NegativeTrustAnchors returns the unexpired negative trust anchors.
+func (c *Context) NegativeTrustAnchors() []NegativeTrustAnchor {
+    c.ntaMu.Lock()
+    defer c.ntaMu.Unlock()
+    c.expireNegativeTrustAnchors()
+    return append([]NegativeTrustAnchor(nil), c.ntas...)
+}
+
+// expireNegativeTrustAnchors drops expired negative trust anchors.
+// ntaMu must be held.
+func (c *Context) expireNegativeTrustAnchors() {
+    now := time.Now()
+    var keep []NegativeTrustAnchor
+    for _, nta := range c.ntas {
+        if nta.Expires.IsZero() || now.Before(nta.Expires) {
+            keep = append(keep, nta)
+        }
+    }
+    c.ntas = keep
+}
+
+// negativeTrustAnchorExtensions returns the extensions to use for a
+// lookup of name, and whether its result needs negative trust anchors
+// applied.
+func (c *Context) negativeTrustAnchorExtensions(name string, exts Dict) (Dict, bool) {
+    if exts["dnssec_return_only_secure"] == EXTENSION_TRUE {
+        return exts, false
+    }
+    if exts["dnssec_return_status"] != EXTENSION_TRUE &&
+        exts["dnssec_return_all_statuses"] != EXTENSION_TRUE &&
+        exts["dnssec_return_validation_chain"] != EXTENSION_TRUE {
+        return exts, false
+    }
+
+    c.ntaMu.Lock()
+    c.expireNegativeTrustAnchors()
+    covered := false
+    name = canonicalName(name)
+    for _, nta := range c.ntas {
+        if isSubdomain(name, nta.Zone) {
+            covered = true
+            break
+        }
+    }
+    c.ntaMu.Unlock()
+    if !covered {
+        return exts, false
+    }
+
+    res := make(Dict, len(exts)+1)
+    for key, val := range exts {
+        res[key] = val
+    }
+    res["dnssec_return_all_statuses"] = EXTENSION_TRUE
+    return res, true
+}
+
+// applyNegativeTrustAnchors reports bogus replies in res as insecure.
+func applyNegativeTrustAnchors(res *C.getdns_dict) {
+    var list *C.getdns_list
+    if ReturnCode(C.getdns_dict_get_list(res, cREPLIES_TREE, &list)) != RETURN_GOOD {
+        return
+    }
+    var n C.size_t
+    if ReturnCode(C.getdns_list_get_length(list, &n)) != RETURN_GOOD {
+        return
+    }
+
+    changed := false
+    for i := C.size_t(0); i < n; i++ {
+        var reply *C.getdns_dict
+        if ReturnCode(C.getdns_list_get_dict(list, i, &reply)) != RETURN_GOOD {
+            continue
+        }
+        var status C.uint32_t
+        if ReturnCode(C.getdns_dict_get_int(reply, cDNSSEC_STATUS, &status)) != RETURN_GOOD {
+            continue
+        }
+        if DNSSECStatus(status) == DNSSEC_BOGUS {
+            C.getdns_dict_set_int(reply, cDNSSEC_STATUS, C.uint32_t(DNSSEC_INSECURE))
+            changed = true
+        }
+    }
+
+    var status C.uint32_t
+    if changed && ReturnCode(C.getdns_dict_get_int(res, cSTATUS, &status)) == RETURN_GOOD && status == RESPSTATUS_NO_ALL_BOGUS_ANSWERS {
+        C.getdns_dict_set_int(res, cSTATUS, RESPSTATUS_GOOD)
+    }
+}
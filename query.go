@@ -0,0 +1,252 @@
+package getdns
+
+// #include <getdns/getdns_extra.h>
+import "C"
+
+import (
+    "context"
+    "time"
+)
+
+// Response is the outcome of an asynchronous lookup. If the lookup
+// did not complete, Err is a CallbackError.
+type Response struct {
+    Result *Result
+    Err    error
+}
+
+// Query is an asynchronous lookup started by one of the Context
+// Query methods. Its channel C delivers a single Response when the
+// lookup finishes. The lookups are driven by the Go event loop, which
+// the first Query lookup installs as SetGoEventLoop does. That fails
+// with RETURN_BAD_CONTEXT if Async lookups are pending on the default
+// event loop; call SetGoEventLoop first to mix the two.
+type Query struct {
+    ID TransactionID
+    C  <-chan Response
+}
+
+func newQuery() (chan Response, Callback) {
+    ch := make(chan Response, 1)
+    return ch, func(res *Result, err error) {
+        ch <- Response{Result: res, Err: err}
+    }
+}
+
+// AddressQuery starts an asynchronous Address lookup and returns a
+// Query that delivers the result.
+func (c *Context) AddressQuery(name string, exts ExtensionSet) (*Query, error) {
+    q, err := c.addressQuery(name, extensionDict(exts), 0)
+    return q, opError("address", name, err)
+}
+
+func (c *Context) addressQuery(name string, exts Dict, timeout uint64) (*Query, error) {
+    err := c.useGoEventLoop()
+    if err != nil {
+        return nil, err
+    }
+    ch, cb := newQuery()
+    tid, err := c.addressAsync(name, exts, timeout, cb)
+    if err != nil {
+        return nil, err
+    }
+    return &Query{ID: tid, C: ch}, nil
+}
+
+// GeneralQuery starts an asynchronous General lookup and returns a
+// Query that delivers the result.
+func (c *Context) GeneralQuery(name string, requestType uint, exts ExtensionSet) (*Query, error) {
+    q, err := c.generalQuery(name, requestType, extensionDict(exts), 0)
+    return q, opError("general", name, err)
+}
+
+func (c *Context) generalQuery(name string, requestType uint, exts Dict, timeout uint64) (*Query, error) {
+    err := c.useGoEventLoop()
+    if err != nil {
+        return nil, err
+    }
+    ch, cb := newQuery()
+    tid, err := c.generalAsync(name, requestType, exts, timeout, cb)
+    if err != nil {
+        return nil, err
+    }
+    return &Query{ID: tid, C: ch}, nil
+}
+
+// HostnameQuery starts an asynchronous Hostname lookup and returns a
+// Query that delivers the result.
+func (c *Context) HostnameQuery(address Dict, exts ExtensionSet) (*Query, error) {
+    q, err := c.hostnameQuery(address, extensionDict(exts), 0)
+    return q, hostnameOpError(address, err)
+}
+
+func (c *Context) hostnameQuery(address Dict, exts Dict, timeout uint64) (*Query, error) {
+    err := c.useGoEventLoop()
+    if err != nil {
+        return nil, err
+    }
+    ch, cb := newQuery()
+    tid, err := c.hostnameAsync(address, exts, timeout, cb)
+    if err != nil {
+        return nil, err
+    }
+    return &Query{ID: tid, C: ch}, nil
+}
+
+// ServiceQuery starts an asynchronous Service lookup and returns a
+// Query that delivers the result.
+func (c *Context) ServiceQuery(name string, exts ExtensionSet) (*Query, error) {
+    q, err := c.serviceQuery(name, extensionDict(exts), 0)
+    return q, opError("service", name, err)
+}
+
+func (c *Context) serviceQuery(name string, exts Dict, timeout uint64) (*Query, error) {
+    err := c.useGoEventLoop()
+    if err != nil {
+        return nil, err
+    }
+    ch, cb := newQuery()
+    tid, err := c.serviceAsync(name, exts, timeout, cb)
+    if err != nil {
+        return nil, err
+    }
+    return &Query{ID: tid, C: ch}, nil
+}
+
+// AddressContext is like Address, but the lookup is cancelled if ctx
+// is done before it completes, and the error is then ctx.Err(). If ctx
+// has a deadline, it replaces the Context timeout for the lookup.
+func (c *Context) AddressContext(ctx context.Context, name string, exts ExtensionSet) (*Result, error) {
+    res, err := c.addressContext(ctx, name, exts)
+    if err != nil && err == ctx.Err() {
+        return nil, err
+    }
+    return res, opError("address", name, err)
+}
+
+func (c *Context) addressContext(ctx context.Context, name string, exts ExtensionSet) (*Result, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    q, err := c.addressQuery(name, extensionDict(exts), deadlineTimeout(ctx))
+    if err != nil {
+        return nil, err
+    }
+    return c.wait(ctx, q)
+}
+
+// GeneralContext is like General, but the lookup is cancelled if ctx
+// is done before it completes.
+func (c *Context) GeneralContext(ctx context.Context, name string, requestType uint, exts ExtensionSet) (*Result, error) {
+    res, err := c.generalContext(ctx, name, requestType, exts)
+    if err != nil && err == ctx.Err() {
+        return nil, err
+    }
+    return res, opError("general", name, err)
+}
+
+func (c *Context) generalContext(ctx context.Context, name string, requestType uint, exts ExtensionSet) (*Result, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    q, err := c.generalQuery(name, requestType, extensionDict(exts), deadlineTimeout(ctx))
+    if err != nil {
+        return nil, err
+    }
+    return c.wait(ctx, q)
+}
+
+// HostnameContext is like Hostname, but the lookup is cancelled if ctx
+// is done before it completes.
+func (c *Context) HostnameContext(ctx context.Context, address Dict, exts ExtensionSet) (*Result, error) {
+    res, err := c.hostnameContext(ctx, address, exts)
+    if err != nil && err == ctx.Err() {
+        return nil, err
+    }
+    return res, hostnameOpError(address, err)
+}
+
+func (c *Context) hostnameContext(ctx context.Context, address Dict, exts ExtensionSet) (*Result, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    q, err := c.hostnameQuery(address, extensionDict(exts), deadlineTimeout(ctx))
+    if err != nil {
+        return nil, err
+    }
+    return c.wait(ctx, q)
+}
+
+// ServiceContext is like Service, but the lookup is cancelled if ctx
+// is done before it completes.
+func (c *Context) ServiceContext(ctx context.Context, name string, exts ExtensionSet) (*Result, error) {
+    res, err := c.serviceContext(ctx, name, exts)
+    if err != nil && err == ctx.Err() {
+        return nil, err
+    }
+    return res, opError("service", name, err)
+}
+
+func (c *Context) serviceContext(ctx context.Context, name string, exts ExtensionSet) (*Result, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    q, err := c.serviceQuery(name, extensionDict(exts), deadlineTimeout(ctx))
+    if err != nil {
+        return nil, err
+    }
+    return c.wait(ctx, q)
+}
+
+// deadlineTimeout returns the time until the ctx deadline in
+// milliseconds, or 0 if ctx has no deadline.
+func deadlineTimeout(ctx context.Context) uint64 {
+    deadline, ok := ctx.Deadline()
+    if !ok {
+        return 0
+    }
+    ms := time.Until(deadline).Milliseconds()
+    if ms < 1 {
+        ms = 1
+    }
+    return uint64(ms)
+}
+
+// wait waits for q to finish or ctx to be done. If ctx is done first,
+// the lookup is cancelled and the ctx error returned.
+func (c *Context) wait(ctx context.Context, q *Query) (*Result, error) {
+    select {
+    case r := <-q.C:
+        return r.Result, r.Err
+
+    case <-ctx.Done():
+        // The lookup may have finished meanwhile, in which case
+        // there is nothing to cancel.
+        c.Cancel(q.ID)
+        return nil, ctx.Err()
+    }
+}
+
+// useGoEventLoop installs the Go event loop to drive Query lookups,
+// unless the Context already has it. Lookups pending on the default
+// loop would be lost by the switch, so then it fails.
+func (c *Context) useGoEventLoop() error {
+    c.mu.Lock()
+    have := c.eventLoop != nil
+    c.mu.Unlock()
+    if have {
+        return nil
+    }
+    busy := false
+    _, err := c.setGoEventLoop(func() bool {
+        if c.eventLoop != nil {
+            return false
+        }
+        busy = c.ctx != nil && C.getdns_context_get_num_pending_requests(c.ctx, nil) != 0
+        return !busy
+    })
+    if err == nil && busy {
+        err = &returnCodeError{RETURN_BAD_CONTEXT}
+    }
+    return err
+}
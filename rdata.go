@@ -0,0 +1,437 @@
+package getdns
+
+import (
+    "net"
+)
+
+// Rdata is the decoded RDATA of a resource record. The concrete type
+// depends on the record type; records of types without a decoder give
+// an *RdataUnknown.
+type Rdata interface {
+    RRType() uint16
+}
+
+// The Rdata types hold the RDATA fields of each record type, named
+// after the fields in the defining RFC.
+
+type RdataA struct {
+    Address net.IP
+}
+
+type RdataAAAA struct {
+    Address net.IP
+}
+
+type RdataNS struct {
+    NSDName string
+}
+
+type RdataCNAME struct {
+    CName string
+}
+
+type RdataPTR struct {
+    PTRDName string
+}
+
+type RdataSOA struct {
+    MName   string
+    RName   string
+    Serial  uint32
+    Refresh uint32
+    Retry   uint32
+    Expire  uint32
+    Minimum uint32
+}
+
+type RdataMX struct {
+    Preference uint16
+    Exchange   string
+}
+
+type RdataTXT struct {
+    Strings []string
+}
+
+type RdataSRV struct {
+    Priority uint16
+    Weight   uint16
+    Port     uint16
+    Target   string
+}
+
+type RdataNAPTR struct {
+    Order       uint16
+    Preference  uint16
+    Flags       string
+    Service     string
+    Regexp      string
+    Replacement string
+}
+
+type RdataDS struct {
+    KeyTag     uint16
+    Algorithm  uint8
+    DigestType uint8
+    Digest     []byte
+}
+
+type RdataDNSKEY struct {
+    Flags     uint16
+    Protocol  uint8
+    Algorithm uint8
+    PublicKey []byte
+}
+
+// RdataRRSIG holds an RRSIG. Expiration and Inception are in seconds
+// since the epoch, modulo 2**32.
+type RdataRRSIG struct {
+    TypeCovered uint16
+    Algorithm   uint8
+    Labels      uint8
+    OriginalTTL uint32
+    Expiration  uint32
+    Inception   uint32
+    KeyTag      uint16
+    SignersName string
+    Signature   []byte
+}
+
+type RdataNSEC struct {
+    NextDomainName string
+    Types          []uint16
+}
+
+type RdataNSEC3 struct {
+    HashAlgorithm       uint8
+    Flags               uint8
+    Iterations          uint16
+    Salt                []byte
+    NextHashedOwnerName []byte
+    Types               []uint16
+}
+
+type RdataTLSA struct {
+    CertificateUsage uint8
+    Selector         uint8
+    MatchingType     uint8
+    Data             []byte
+}
+
+type RdataCAA struct {
+    Flags uint8
+    Tag   string
+    Value string
+}
+
+type RdataSSHFP struct {
+    Algorithm   uint8
+    FPType      uint8
+    Fingerprint []byte
+}
+
+type RdataURI struct {
+    Priority uint16
+    Weight   uint16
+    Target   string
+}
+
+type RdataOPENPGPKEY struct {
+    PublicKey []byte
+}
+
+// RdataUnknown holds the raw RDATA of a record type without a decoder.
+type RdataUnknown struct {
+    Type uint16
+    Raw  []byte
+}
+
+func (*RdataA) RRType() uint16          { return RRTYPE_A }
+func (*RdataAAAA) RRType() uint16       { return RRTYPE_AAAA }
+func (*RdataNS) RRType() uint16         { return RRTYPE_NS }
+func (*RdataCNAME) RRType() uint16      { return RRTYPE_CNAME }
+func (*RdataPTR) RRType() uint16        { return RRTYPE_PTR }
+func (*RdataSOA) RRType() uint16        { return RRTYPE_SOA }
+func (*RdataMX) RRType() uint16         { return RRTYPE_MX }
+func (*RdataTXT) RRType() uint16        { return RRTYPE_TXT }
+func (*RdataSRV) RRType() uint16        { return RRTYPE_SRV }
+func (*RdataNAPTR) RRType() uint16      { return RRTYPE_NAPTR }
+func (*RdataDS) RRType() uint16         { return RRTYPE_DS }
+func (*RdataDNSKEY) RRType() uint16     { return RRTYPE_DNSKEY }
+func (*RdataRRSIG) RRType() uint16      { return RRTYPE_RRSIG }
+func (*RdataNSEC) RRType() uint16       { return RRTYPE_NSEC }
+func (*RdataNSEC3) RRType() uint16      { return RRTYPE_NSEC3 }
+func (*RdataTLSA) RRType() uint16       { return RRTYPE_TLSA }
+func (*RdataCAA) RRType() uint16        { return RRTYPE_CAA }
+func (*RdataSSHFP) RRType() uint16      { return RRTYPE_SSHFP }
+func (*RdataURI) RRType() uint16        { return RRTYPE_URI }
+func (*RdataOPENPGPKEY) RRType() uint16 { return RRTYPE_OPENPGPKEY }
+func (r *RdataUnknown) RRType() uint16  { return r.Type }
+
+// KeyTag returns the key tag of the DNSKEY, as defined in RFC 4034
+// Appendix B.
+func (r *RdataDNSKEY) KeyTag() uint16 {
+    wire := make([]byte, 4, 4+len(r.PublicKey))
+    wire[0] = byte(r.Flags >> 8)
+    wire[1] = byte(r.Flags)
+    wire[2] = r.Protocol
+    wire[3] = r.Algorithm
+    wire = append(wire, r.PublicKey...)
+
+    var ac uint32
+    for i, b := range wire {
+        if i&1 != 0 {
+            ac += uint32(b)
+        } else {
+            ac += uint32(b) << 8
+        }
+    }
+    ac += ac >> 16 & 0xffff
+    return uint16(ac)
+}
+
+// Decode returns the typed RDATA of the record.
+func (rr *RR) Decode() (Rdata, error) {
+    return DecodeRdata(rr.Type, rr.Rdata)
+}
+
+// DecodeRdata decodes a getdns rdata dict for a record of the given
+// type. Domain names are converted to FQDNs. If there is no decoder
+// for the type, the result is an *RdataUnknown holding rdata_raw.
+func DecodeRdata(rrtype uint16, d Dict) (Rdata, error) {
+    var err error
+    r := rdataReader{d: d}
+
+    switch rrtype {
+    case RRTYPE_A:
+        return &RdataA{Address: net.IP(r.bytes("ipv4_address"))}, r.err
+
+    case RRTYPE_AAAA:
+        return &RdataAAAA{Address: net.IP(r.bytes("ipv6_address"))}, r.err
+
+    case RRTYPE_NS:
+        return &RdataNS{NSDName: r.name("nsdname")}, r.err
+
+    case RRTYPE_CNAME:
+        return &RdataCNAME{CName: r.name("cname")}, r.err
+
+    case RRTYPE_PTR:
+        return &RdataPTR{PTRDName: r.name("ptrdname")}, r.err
+
+    case RRTYPE_SOA:
+        return &RdataSOA{
+            MName:   r.name("mname"),
+            RName:   r.name("rname"),
+            Serial:  r.uint32("serial"),
+            Refresh: r.uint32("refresh"),
+            Retry:   r.uint32("retry"),
+            Expire:  r.uint32("expire"),
+            Minimum: r.uint32("minimum"),
+        }, r.err
+
+    case RRTYPE_MX:
+        return &RdataMX{
+            Preference: r.uint16("preference"),
+            Exchange:   r.name("exchange"),
+        }, r.err
+
+    case RRTYPE_TXT:
+        var l List
+        l, err = dictList(d, "txt_strings")
+        if err != nil {
+            return nil, err
+        }
+        res := &RdataTXT{Strings: make([]string, 0, len(l))}
+        for _, item := range l {
+            b, ok := item.([]byte)
+            if !ok {
+                return nil, &returnCodeError{RETURN_WRONG_TYPE_REQUESTED}
+            }
+            res.Strings = append(res.Strings, string(b))
+        }
+        return res, nil
+
+    case RRTYPE_SRV:
+        return &RdataSRV{
+            Priority: r.uint16("priority"),
+            Weight:   r.uint16("weight"),
+            Port:     r.uint16("port"),
+            Target:   r.name("target"),
+        }, r.err
+
+    case RRTYPE_NAPTR:
+        return &RdataNAPTR{
+            Order:       r.uint16("order"),
+            Preference:  r.uint16("preference"),
+            Flags:       string(r.bytes("flags")),
+            Service:     string(r.bytes("service")),
+            Regexp:      string(r.bytes("regexp")),
+            Replacement: r.name("replacement"),
+        }, r.err
+
+    case RRTYPE_DS:
+        return &RdataDS{
+            KeyTag:     r.uint16("key_tag"),
+            Algorithm:  r.uint8("algorithm"),
+            DigestType: r.uint8("digest_type"),
+            Digest:     r.bytes("digest"),
+        }, r.err
+
+    case RRTYPE_DNSKEY:
+        return &RdataDNSKEY{
+            Flags:     r.uint16("flags"),
+            Protocol:  r.uint8("protocol"),
+            Algorithm: r.uint8("algorithm"),
+            PublicKey: r.bytes("public_key"),
+        }, r.err
+
+    case RRTYPE_RRSIG:
+        return &RdataRRSIG{
+            TypeCovered: r.uint16("type_covered"),
+            Algorithm:   r.uint8("algorithm"),
+            Labels:      r.uint8("labels"),
+            OriginalTTL: r.uint32("original_ttl"),
+            Expiration:  r.uint32("signature_expiration"),
+            Inception:   r.uint32("signature_inception"),
+            KeyTag:      r.uint16("key_tag"),
+            SignersName: r.name("signers_name"),
+            Signature:   r.bytes("signature"),
+        }, r.err
+
+    case RRTYPE_NSEC:
+        return &RdataNSEC{
+            NextDomainName: r.name("next_domain_name"),
+            Types:          r.types("type_bit_maps"),
+        }, r.err
+
+    case RRTYPE_NSEC3:
+        return &RdataNSEC3{
+            HashAlgorithm:       r.uint8("hash_algorithm"),
+            Flags:               r.uint8("flags"),
+            Iterations:          r.uint16("iterations"),
+            Salt:                r.bytes("salt"),
+            NextHashedOwnerName: r.bytes("next_hashed_owner_name"),
+            Types:               r.types("type_bit_maps"),
+        }, r.err
+
+    case RRTYPE_TLSA:
+        return &RdataTLSA{
+            CertificateUsage: r.uint8("certificate_usage"),
+            Selector:         r.uint8("selector"),
+            MatchingType:     r.uint8("matching_type"),
+            Data:             r.bytes("certificate_association_data"),
+        }, r.err
+
+    case RRTYPE_CAA:
+        return &RdataCAA{
+            Flags: r.uint8("flags"),
+            Tag:   string(r.bytes("tag")),
+            Value: string(r.bytes("value")),
+        }, r.err
+
+    case RRTYPE_SSHFP:
+        return &RdataSSHFP{
+            Algorithm:   r.uint8("algorithm"),
+            FPType:      r.uint8("fp_type"),
+            Fingerprint: r.bytes("fingerprint"),
+        }, r.err
+
+    case RRTYPE_URI:
+        return &RdataURI{
+            Priority: r.uint16("priority"),
+            Weight:   r.uint16("weight"),
+            Target:   string(r.bytes("target")),
+        }, r.err
+
+    case RRTYPE_OPENPGPKEY:
+        return &RdataOPENPGPKEY{PublicKey: r.bytes("transferable_public_key")}, r.err
+
+    default:
+        var raw []byte
+        raw, err = dictBytes(d, "rdata_raw")
+        if err != nil {
+            return nil, err
+        }
+        return &RdataUnknown{Type: rrtype, Raw: raw}, nil
+    }
+}
+
+// rdataReader reads rdata dict fields, remembering the first error.
+type rdataReader struct {
+    d   Dict
+    err error
+}
+
+func (r *rdataReader) int(key string) int {
+    if r.err != nil {
+        return 0
+    }
+    val, err := dictInt(r.d, key)
+    r.err = err
+    return val
+}
+
+func (r *rdataReader) uint8(key string) uint8 {
+    return uint8(r.int(key))
+}
+
+func (r *rdataReader) uint16(key string) uint16 {
+    return uint16(r.int(key))
+}
+
+func (r *rdataReader) uint32(key string) uint32 {
+    return uint32(r.int(key))
+}
+
+func (r *rdataReader) bytes(key string) []byte {
+    if r.err != nil {
+        return nil
+    }
+    val, err := dictBytes(r.d, key)
+    r.err = err
+    return val
+}
+
+func (r *rdataReader) name(key string) string {
+    if r.err != nil {
+        return ""
+    }
+    val, err := dictName(r.d, key)
+    r.err = err
+    return val
+}
+
+func (r *rdataReader) types(key string) []uint16 {
+    b := r.bytes(key)
+    if r.err != nil {
+        return nil
+    }
+    val, err := decodeTypeBitMaps(b)
+    r.err = err
+    return val
+}
+
+// decodeTypeBitMaps decodes an NSEC or NSEC3 type bit map field into
+// the list of types present.
+func decodeTypeBitMaps(b []byte) ([]uint16, error) {
+    var res []uint16
+    for len(b) > 0 {
+        if len(b) < 2 {
+            return nil, &returnCodeError{RETURN_GENERIC_ERROR}
+        }
+        window := uint16(b[0]) << 8
+        n := int(b[1])
+        if n < 1 || n > 32 || len(b) < 2+n {
+            return nil, &returnCodeError{RETURN_GENERIC_ERROR}
+        }
+        for i, bits := range b[2 : 2+n] {
+            for j := 0; j < 8; j++ {
+                if bits&(0x80>>uint(j)) != 0 {
+                    res = append(res, window|uint16(i*8+j))
+                }
+            }
+        }
+        b = b[2+n:]
+    }
+    return res, nil
+}
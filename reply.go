@@ -0,0 +1,385 @@
+package getdns
+
+import "fmt"
+
+// Header is the header of a DNS reply.
+type Header struct {
+    ID      uint16
+    QR      bool
+    Opcode  int
+    AA      bool
+    TC      bool
+    RD      bool
+    RA      bool
+    Z       int
+    AD      bool
+    CD      bool
+    Rcode   int
+    QDCount int
+    ANCount int
+    NSCount int
+    ARCount int
+}
+
+// Question is the question section of a DNS reply.
+type Question struct {
+    Name  string
+    Type  uint16
+    Class uint16
+}
+
+// RR is a resource record from a DNS reply. Rdata holds the getdns
+// rdata dict for the record.
+type RR struct {
+    Name  string
+    Type  uint16
+    Class uint16
+    TTL   uint32
+    Rdata Dict
+}
+
+// BadDNS is a problem reported by the add_warning_for_bad_dns
+// extension, one of the BAD_DNS values. Codes added by newer getdns
+// releases are kept as reported.
+type BadDNS int
+
+// String returns the name of the BAD_DNS value.
+func (b BadDNS) String() string {
+    switch b {
+    case BAD_DNS_CNAME_IN_TARGET:
+        return "BAD_DNS_CNAME_IN_TARGET"
+    case BAD_DNS_ALL_NUMERIC_LABEL:
+        return "BAD_DNS_ALL_NUMERIC_LABEL"
+    case BAD_DNS_CNAME_RETURNED_FOR_OTHER_TYPE:
+        return "BAD_DNS_CNAME_RETURNED_FOR_OTHER_TYPE"
+    }
+    return fmt.Sprintf("BAD_DNS %d", int(b))
+}
+
+// Reply is a single DNS reply from a lookup, decoded from its getdns
+// dict in Result.RepliesTree.
+type Reply struct {
+    Header        Header
+    Question      Question
+    Answer        []RR
+    Authority     []RR
+    Additional    []RR
+    CanonicalName string
+    AnswerType    Nametype
+    DNSSECStatus  DNSSECStatus
+    // BadDNS lists the problems found with the add_warning_for_bad_dns
+    // extension.
+    BadDNS []BadDNS
+}
+
+// Replies returns the typed replies from the result.
+func (r *Result) Replies() ([]*Reply, error) {
+    rt, err := r.RepliesTree()
+    if err != nil {
+        return nil, err
+    }
+
+    res := make([]*Reply, 0, len(rt))
+    for _, item := range rt {
+        d, ok := item.(Dict)
+        if !ok {
+            return nil, &returnCodeError{RETURN_WRONG_TYPE_REQUESTED}
+        }
+        reply, err := ReplyFromDict(d)
+        if err != nil {
+            return nil, err
+        }
+        res = append(res, reply)
+    }
+    return res, nil
+}
+
+// ReplyFromDict decodes a reply dict, as found in Result.RepliesTree.
+// If the dict has no dnssec_status, the reply's DNSSECStatus is
+// DNSSEC_NOT_PERFORMED.
+func ReplyFromDict(d Dict) (*Reply, error) {
+    res := &Reply{DNSSECStatus: DNSSEC_NOT_PERFORMED}
+
+    hd, err := dictDict(d, "header")
+    if err != nil {
+        return nil, err
+    }
+    res.Header, err = headerFromDict(hd)
+    if err != nil {
+        return nil, err
+    }
+
+    qd, err := dictDict(d, "question")
+    if err != nil {
+        return nil, err
+    }
+    res.Question, err = questionFromDict(qd)
+    if err != nil {
+        return nil, err
+    }
+
+    res.Answer, err = sectionFromDict(d, "answer")
+    if err != nil {
+        return nil, err
+    }
+    res.Authority, err = sectionFromDict(d, "authority")
+    if err != nil {
+        return nil, err
+    }
+    res.Additional, err = sectionFromDict(d, "additional")
+    if err != nil {
+        return nil, err
+    }
+
+    if _, ok := d["canonical_name"]; ok {
+        res.CanonicalName, err = dictName(d, "canonical_name")
+        if err != nil {
+            return nil, err
+        }
+    }
+    if _, ok := d["answer_type"]; ok {
+        at, err := dictInt(d, "answer_type")
+        if err != nil {
+            return nil, err
+        }
+        res.AnswerType = Nametype(at)
+    }
+    if _, ok := d["dnssec_status"]; ok {
+        ds, err := dictInt(d, "dnssec_status")
+        if err != nil {
+            return nil, err
+        }
+        res.DNSSECStatus = DNSSECStatus(ds)
+    }
+    if _, ok := d["bad_dns"]; ok {
+        l, err := dictList(d, "bad_dns")
+        if err != nil {
+            return nil, err
+        }
+        for _, item := range l {
+            code, ok := item.(int)
+            if !ok {
+                return nil, &returnCodeError{RETURN_WRONG_TYPE_REQUESTED}
+            }
+            res.BadDNS = append(res.BadDNS, BadDNS(code))
+        }
+    }
+
+    return res, nil
+}
+
+// RRFromDict decodes a resource record dict, as found in the sections
+// of a reply dict.
+func RRFromDict(d Dict) (RR, error) {
+    var res RR
+    var err error
+
+    res.Name, err = dictName(d, "name")
+    if err != nil {
+        return res, err
+    }
+    rrtype, err := dictInt(d, "type")
+    if err != nil {
+        return res, err
+    }
+    res.Type = uint16(rrtype)
+
+    // OPT records have no class or TTL; their fields are stored
+    // under their own names, and are put in Class and TTL as in the
+    // wire format.
+    if rrtype == RRTYPE_OPT {
+        res.Class, res.TTL = optClassTTL(d)
+    } else {
+        class, err := dictInt(d, "class")
+        if err != nil {
+            return res, err
+        }
+        res.Class = uint16(class)
+        ttl, err := dictInt(d, "ttl")
+        if err != nil {
+            return res, err
+        }
+        res.TTL = uint32(ttl)
+    }
+
+    res.Rdata, err = dictDict(d, "rdata")
+    if err != nil {
+        return res, err
+    }
+    return res, nil
+}
+
+// optClassTTL returns the class and TTL fields of an OPT record dict.
+// Missing fields are zero.
+func optClassTTL(d Dict) (uint16, uint32) {
+    field := func(key string) uint32 {
+        val, err := dictInt(d, key)
+        if err != nil {
+            return 0
+        }
+        return uint32(val)
+    }
+    ttl := field("extended_rcode")<<24 | field("version")<<16 | field("do")<<15 | field("z")&0x7fff
+    return uint16(field("udp_payload_size")), ttl
+}
+
+// OPT is the EDNS(0) OPT record of a reply.
+type OPT struct {
+    UDPPayloadSize uint16
+    ExtendedRcode  uint8
+    Version        uint8
+    DoBit          bool
+    Options        []EDNSOption
+}
+
+// OPT returns the OPT record from the additional section of the reply,
+// or nil if there is none.
+func (r *Reply) OPT() (*OPT, error) {
+    for _, rr := range r.Additional {
+        if rr.Type != RRTYPE_OPT {
+            continue
+        }
+        res := &OPT{
+            UDPPayloadSize: rr.Class,
+            ExtendedRcode:  uint8(rr.TTL >> 24),
+            Version:        uint8(rr.TTL >> 16),
+            DoBit:          rr.TTL&0x8000 != 0,
+        }
+        if _, ok := rr.Rdata["options"]; !ok {
+            return res, nil
+        }
+        l, err := dictList(rr.Rdata, "options")
+        if err != nil {
+            return nil, err
+        }
+        for _, item := range l {
+            od, ok := item.(Dict)
+            if !ok {
+                return nil, &returnCodeError{RETURN_WRONG_TYPE_REQUESTED}
+            }
+            code, err := dictInt(od, "option_code")
+            if err != nil {
+                return nil, err
+            }
+            data, err := dictBytes(od, "option_data")
+            if err != nil {
+                return nil, err
+            }
+            res.Options = append(res.Options, EDNSOption{Code: uint16(code), Data: data})
+        }
+        return res, nil
+    }
+    return nil, nil
+}
+
+// Option returns the decoded data of the first option with the given
+// code, or nil if there is none.
+func (o *OPT) Option(code uint16) (EDNSOptionData, error) {
+    for _, opt := range o.Options {
+        if opt.Code == code {
+            return opt.Decode()
+        }
+    }
+    return nil, nil
+}
+
+func headerFromDict(d Dict) (Header, error) {
+    var res Header
+    fields := []struct {
+        key string
+        val *int
+    }{
+        {"opcode", &res.Opcode},
+        {"z", &res.Z},
+        {"rcode", &res.Rcode},
+        {"qdcount", &res.QDCount},
+        {"ancount", &res.ANCount},
+        {"nscount", &res.NSCount},
+        {"arcount", &res.ARCount},
+    }
+    for _, f := range fields {
+        val, err := dictInt(d, f.key)
+        if err != nil {
+            return res, err
+        }
+        *f.val = val
+    }
+
+    flags := []struct {
+        key string
+        val *bool
+    }{
+        {"qr", &res.QR},
+        {"aa", &res.AA},
+        {"tc", &res.TC},
+        {"rd", &res.RD},
+        {"ra", &res.RA},
+        {"ad", &res.AD},
+        {"cd", &res.CD},
+    }
+    for _, f := range flags {
+        val, err := dictInt(d, f.key)
+        if err != nil {
+            return res, err
+        }
+        *f.val = val != 0
+    }
+
+    id, err := dictInt(d, "id")
+    if err != nil {
+        return res, err
+    }
+    res.ID = uint16(id)
+    return res, nil
+}
+
+func questionFromDict(d Dict) (Question, error) {
+    var res Question
+    var err error
+
+    res.Name, err = dictName(d, "qname")
+    if err != nil {
+        return res, err
+    }
+    qtype, err := dictInt(d, "qtype")
+    if err != nil {
+        return res, err
+    }
+    res.Type = uint16(qtype)
+    qclass, err := dictInt(d, "qclass")
+    if err != nil {
+        return res, err
+    }
+    res.Class = uint16(qclass)
+    return res, nil
+}
+
+// sectionFromDict decodes a reply section. A missing section is empty.
+func sectionFromDict(d Dict, key string) ([]RR, error) {
+    if _, ok := d[key]; !ok {
+        return nil, nil
+    }
+    l, err := dictList(d, key)
+    if err != nil {
+        return nil, err
+    }
+    return RRsFromList(l)
+}
+
+// RRsFromList decodes a list of RR dicts, such as a reply section or
+// the records read by ReadZone.
+func RRsFromList(l List) ([]RR, error) {
+    res := make([]RR, 0, len(l))
+    for _, item := range l {
+        rrd, ok := item.(Dict)
+        if !ok {
+            return nil, &returnCodeError{RETURN_WRONG_TYPE_REQUESTED}
+        }
+        rr, err := RRFromDict(rrd)
+        if err != nil {
+            return nil, err
+        }
+        res = append(res, rr)
+    }
+    return res, nil
+}
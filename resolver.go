@@ -0,0 +1,338 @@
+package getdns
+
+import (
+    "context"
+    "errors"
+    "net"
+    "net/netip"
+    "sort"
+    "strings"
+)
+
+// Resolver looks up names using a Context. It has the method set of
+// net.Resolver, so it can replace one at call sites that take an
+// interface, and its errors are *net.DNSError values.
+type Resolver struct {
+    Context *Context
+
+    // Extensions are used for every lookup, for example to request
+    // DNSSEC validation with dnssec_return_only_secure.
+    Extensions ExtensionSet
+}
+
+// NewResolver returns a Resolver that looks up names using c.
+func NewResolver(c *Context) *Resolver {
+    return &Resolver{Context: c}
+}
+
+// LookupHost looks up host, returning its addresses.
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+    if _, err := netip.ParseAddr(host); err == nil {
+        return []string{host}, nil
+    }
+    addrs, err := r.LookupIPAddr(ctx, host)
+    if err != nil {
+        return nil, err
+    }
+    res := make([]string, len(addrs))
+    for i, addr := range addrs {
+        res[i] = addr.String()
+    }
+    return res, nil
+}
+
+// LookupIPAddr looks up host, returning its IPv4 and IPv6 addresses.
+func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+    if ip, err := netip.ParseAddr(host); err == nil {
+        return []net.IPAddr{{IP: ip.AsSlice(), Zone: ip.Zone()}}, nil
+    }
+    addrs, err := r.lookupAddresses(ctx, host)
+    if err != nil {
+        return nil, err
+    }
+    res := make([]net.IPAddr, len(addrs))
+    for i, addr := range addrs {
+        res[i] = net.IPAddr{IP: addr.AsSlice()}
+    }
+    return res, nil
+}
+
+// LookupNetIP looks up host, returning addresses for network, which
+// is "ip", "ip4" or "ip6".
+func (r *Resolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+    var want func(netip.Addr) bool
+    switch network {
+    case "ip":
+        want = func(netip.Addr) bool { return true }
+    case "ip4":
+        want = netip.Addr.Is4
+    case "ip6":
+        want = netip.Addr.Is6
+    default:
+        return nil, &net.DNSError{Err: "unknown network " + network, Name: host}
+    }
+
+    var addrs []netip.Addr
+    if ip, err := netip.ParseAddr(host); err == nil {
+        addrs = []netip.Addr{ip}
+    } else {
+        addrs, err = r.lookupAddresses(ctx, host)
+        if err != nil {
+            return nil, err
+        }
+    }
+    var res []netip.Addr
+    for _, addr := range addrs {
+        if want(addr) {
+            res = append(res, addr)
+        }
+    }
+    if len(res) == 0 {
+        return nil, notFoundError(host)
+    }
+    return res, nil
+}
+
+// LookupCNAME returns the canonical name of host, after following any
+// CNAME records.
+func (r *Resolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+    res, err := r.Context.AddressContext(ctx, host, r.Extensions)
+    if err != nil {
+        return "", dnsError(err, host)
+    }
+    defer res.Destroy()
+    err = statusError(res, host)
+    if err != nil {
+        return "", err
+    }
+    cname, err := res.CanonicalName()
+    if err != nil {
+        return "", dnsError(err, host)
+    }
+    return cname, nil
+}
+
+// LookupMX returns the MX records for name, sorted by preference.
+func (r *Resolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+    rds, err := r.lookupRdata(ctx, name, RRTYPE_MX)
+    if err != nil {
+        return nil, err
+    }
+    res := make([]*net.MX, len(rds))
+    for i, rd := range rds {
+        mx := rd.(*RdataMX)
+        res[i] = &net.MX{Host: mx.Exchange, Pref: mx.Preference}
+    }
+    sort.SliceStable(res, func(i, j int) bool { return res[i].Pref < res[j].Pref })
+    return res, nil
+}
+
+// LookupNS returns the NS records for name.
+func (r *Resolver) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+    rds, err := r.lookupRdata(ctx, name, RRTYPE_NS)
+    if err != nil {
+        return nil, err
+    }
+    res := make([]*net.NS, len(rds))
+    for i, rd := range rds {
+        res[i] = &net.NS{Host: rd.(*RdataNS).NSDName}
+    }
+    return res, nil
+}
+
+// LookupSRV looks up the SRV records for _service._proto.name, or for
+// name if service and proto are empty. It returns the canonical name
+// looked up and the records sorted by priority and randomised by
+// weight.
+func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+    target := name
+    if service != "" || proto != "" {
+        target = "_" + service + "._" + proto + "." + name
+    }
+
+    res, err := r.Context.ServiceContext(ctx, target, r.Extensions)
+    if err != nil {
+        return "", nil, dnsError(err, target)
+    }
+    defer res.Destroy()
+    err = statusError(res, target)
+    if err != nil {
+        return "", nil, err
+    }
+    targets, err := res.SRVTargets()
+    if err != nil {
+        return "", nil, dnsError(err, target)
+    }
+    if len(targets) == 0 {
+        return "", nil, notFoundError(target)
+    }
+    cname, err := res.CanonicalName()
+    if err != nil {
+        cname = canonicalName(target)
+    }
+
+    srvs := make([]*net.SRV, len(targets))
+    for i, t := range targets {
+        srvs[i] = &net.SRV{Target: t.Target, Port: t.Port, Priority: t.Priority, Weight: t.Weight}
+    }
+    return cname, srvs, nil
+}
+
+// LookupTXT returns the TXT records for name. The strings of each
+// record are joined.
+func (r *Resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+    rds, err := r.lookupRdata(ctx, name, RRTYPE_TXT)
+    if err != nil {
+        return nil, err
+    }
+    res := make([]string, len(rds))
+    for i, rd := range rds {
+        res[i] = strings.Join(rd.(*RdataTXT).Strings, "")
+    }
+    return res, nil
+}
+
+// LookupAddr performs a reverse lookup of addr, returning its names.
+func (r *Resolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+    ip, err := netip.ParseAddr(addr)
+    if err != nil {
+        return nil, &net.DNSError{Err: "unrecognized address", Name: addr}
+    }
+    addrType := "IPv6"
+    if ip.Unmap().Is4() {
+        ip = ip.Unmap()
+        addrType = "IPv4"
+    }
+
+    res, err := r.Context.HostnameContext(ctx, Dict{"address_type": addrType, "address_data": ip.String()}, r.Extensions)
+    if err != nil {
+        return nil, dnsError(err, addr)
+    }
+    defer res.Destroy()
+    rds, err := rdataFromResult(res, addr, RRTYPE_PTR)
+    if err != nil {
+        return nil, err
+    }
+    names := make([]string, len(rds))
+    for i, rd := range rds {
+        names[i] = rd.(*RdataPTR).PTRDName
+    }
+    return names, nil
+}
+
+func (r *Resolver) lookupAddresses(ctx context.Context, host string) ([]netip.Addr, error) {
+    res, err := r.Context.AddressContext(ctx, host, r.Extensions)
+    if err != nil {
+        return nil, dnsError(err, host)
+    }
+    defer res.Destroy()
+    err = statusError(res, host)
+    if err != nil {
+        return nil, err
+    }
+    answers, err := res.JustAddressAnswers()
+    if err != nil {
+        return nil, dnsError(err, host)
+    }
+
+    var addrs []netip.Addr
+    for _, d := range answers {
+        s, _ := d["address_data"].(string)
+        addr, err := netip.ParseAddr(s)
+        if err == nil {
+            addrs = append(addrs, addr)
+        }
+    }
+    if len(addrs) == 0 {
+        return nil, notFoundError(host)
+    }
+    return addrs, nil
+}
+
+func (r *Resolver) lookupRdata(ctx context.Context, name string, rrtype uint) ([]Rdata, error) {
+    res, err := r.Context.GeneralContext(ctx, name, rrtype, r.Extensions)
+    if err != nil {
+        return nil, dnsError(err, name)
+    }
+    defer res.Destroy()
+    return rdataFromResult(res, name, uint16(rrtype))
+}
+
+// rdataFromResult returns the decoded answers of type rrtype in res.
+func rdataFromResult(res *Result, name string, rrtype uint16) ([]Rdata, error) {
+    err := statusError(res, name)
+    if err != nil {
+        return nil, err
+    }
+    replies, err := res.Replies()
+    if err != nil {
+        return nil, dnsError(err, name)
+    }
+
+    var rds []Rdata
+    for _, reply := range replies {
+        for _, rr := range reply.Answer {
+            if rr.Type != rrtype {
+                continue
+            }
+            rd, err := rr.Decode()
+            if err != nil {
+                return nil, dnsError(err, name)
+            }
+            rds = append(rds, rd)
+        }
+    }
+    if len(rds) == 0 {
+        return nil, notFoundError(name)
+    }
+    return rds, nil
+}
+
+// statusError returns a *net.DNSError if the status of res is not
+// RESPSTATUS_GOOD.
+func statusError(res *Result, name string) error {
+    status, err := res.Status()
+    if err != nil {
+        return dnsError(err, name)
+    }
+    switch status {
+    case RESPSTATUS_GOOD:
+        return nil
+    case RESPSTATUS_NO_NAME:
+        return notFoundError(name)
+    case RESPSTATUS_ALL_TIMEOUT:
+        return &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true, IsTemporary: true}
+    case RESPSTATUS_NO_SECURE_ANSWERS:
+        return &net.DNSError{Err: "no secure answers", Name: name}
+    case RESPSTATUS_NO_ALL_BOGUS_ANSWERS:
+        return &net.DNSError{Err: "all answers bogus", Name: name}
+    default:
+        return &net.DNSError{Err: "lookup failed", Name: name}
+    }
+}
+
+func notFoundError(name string) error {
+    return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+// dnsError converts err from a lookup of name to a *net.DNSError.
+func dnsError(err error, name string) error {
+    var oe *OpError
+    if errors.As(err, &oe) {
+        err = oe.Err
+    }
+    de := &net.DNSError{Err: err.Error(), Name: name}
+    var cbe CallbackError
+    switch {
+    case errors.Is(err, context.DeadlineExceeded):
+        de.IsTimeout = true
+        de.IsTemporary = true
+    case errors.Is(err, context.Canceled):
+        de.Err = "operation was canceled"
+    case errors.As(err, &cbe) && cbe.CallbackType() == CALLBACK_TIMEOUT:
+        de.Err = "i/o timeout"
+        de.IsTimeout = true
+        de.IsTemporary = true
+    }
+    return de
+}
@@ -5,7 +5,9 @@ package getdns
 import "C"
 
 import (
+    "fmt"
     "runtime"
+    "strings"
     "unsafe"
 )
 
@@ -107,3 +109,91 @@ func (r *Result) ValidationChain() (List, error) {
 func (r *Result) Status() (uint32, error) {
     return r.getInt("status")
 }
+
+// ResponseError reports a lookup whose response status is not
+// RESPSTATUS_GOOD. Rcode is the rcode of the reply that explains the
+// failure, including any extended rcode bits, and EDE is its Extended
+// DNS Error option if it has one. Both are unset if no reply was
+// received.
+type ResponseError struct {
+    Status uint32
+    Rcode  int
+    EDE    *EDNSExtendedError
+}
+
+// Error implements the error interface and returns a printable
+// description of the error.
+func (err *ResponseError) Error() string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "getdns response: %s, rcode %s", responseStatusText(err.Status), rcodeString(err.Rcode))
+    if err.EDE != nil {
+        fmt.Fprintf(&b, ", EDE %d (%s)", uint16(err.EDE.InfoCode), err.EDE.InfoCode)
+        if err.EDE.ExtraText != "" {
+            fmt.Fprintf(&b, ": %s", err.EDE.ExtraText)
+        }
+    }
+    return b.String()
+}
+
+// Unwrap returns the error type for the response status: a
+// *NoNameError, *AllTimeoutError, *NoSecureAnswersError or
+// *AllBogusError.
+func (err *ResponseError) Unwrap() error {
+    return responseStatusError(err.Status)
+}
+
+// Err returns a *ResponseError if the response status of the result is
+// not RESPSTATUS_GOOD, and nil otherwise. The reply chosen to explain
+// the failure is the first with an Extended DNS Error, or else the
+// first with a non-zero rcode.
+func (r *Result) Err() error {
+    status, err := r.Status()
+    if err != nil {
+        return err
+    }
+    if status == RESPSTATUS_GOOD {
+        return nil
+    }
+
+    res := &ResponseError{Status: status}
+    replies, err := r.Replies()
+    if err != nil {
+        return res
+    }
+    found := false
+    for _, reply := range replies {
+        rcode := reply.Header.Rcode
+        opt, err := reply.OPT()
+        if err != nil {
+            continue
+        }
+        var ede *EDNSExtendedError
+        if opt != nil {
+            rcode |= int(opt.ExtendedRcode) << 4
+            if data, err := opt.Option(EDNS_OPTION_EDE); err == nil && data != nil {
+                ede = data.(*EDNSExtendedError)
+            }
+        }
+        if ede != nil {
+            res.Rcode, res.EDE = rcode, ede
+            break
+        }
+        if !found && rcode != 0 {
+            res.Rcode = rcode
+            found = true
+        }
+    }
+    return res
+}
+
+var rcodeNames = []string{
+    "NOERROR", "FORMERR", "SERVFAIL", "NXDOMAIN", "NOTIMP", "REFUSED",
+    "YXDOMAIN", "YXRRSET", "NXRRSET", "NOTAUTH", "NOTZONE",
+}
+
+func rcodeString(rcode int) string {
+    if rcode >= 0 && rcode < len(rcodeNames) {
+        return rcodeNames[rcode]
+    }
+    return fmt.Sprintf("%d", rcode)
+}
@@ -0,0 +1,181 @@
+package getdns
+
+import (
+    "context"
+    "math/rand"
+    "net/netip"
+    "sort"
+)
+
+// SRVTarget is a service target from an SRV record, with its
+// addresses.
+type SRVTarget struct {
+    Target    string
+    Port      uint16
+    Priority  uint16
+    Weight    uint16
+    Addresses []netip.Addr
+}
+
+// SRVTargets are service targets in the order to try them.
+type SRVTargets []SRVTarget
+
+// Next removes and returns the first target, for trying each target
+// in turn. It returns false when there are no targets left.
+func (t *SRVTargets) Next() (SRVTarget, bool) {
+    if len(*t) == 0 {
+        return SRVTarget{}, false
+    }
+    res := (*t)[0]
+    *t = (*t)[1:]
+    return res, true
+}
+
+// SRVTargets returns the targets of the SRV records in r, sorted by
+// priority and randomised by weight following RFC 2782. Addresses are
+// taken from the srv_addresses list when getdns provides one. A single
+// target of "." means the service is not available, and gives no
+// targets.
+func (r *Result) SRVTargets() (SRVTargets, error) {
+    replies, err := r.Replies()
+    if err != nil {
+        return nil, err
+    }
+    var res SRVTargets
+    for _, reply := range replies {
+        for _, rr := range reply.Answer {
+            if rr.Type != RRTYPE_SRV {
+                continue
+            }
+            rd, err := rr.Decode()
+            if err != nil {
+                return nil, err
+            }
+            srv := rd.(*RdataSRV)
+            res = append(res, SRVTarget{
+                Target:   srv.Target,
+                Port:     srv.Port,
+                Priority: srv.Priority,
+                Weight:   srv.Weight,
+            })
+        }
+    }
+    if len(res) == 1 && res[0].Target == "." {
+        return nil, nil
+    }
+
+    full, err := r.RepliesFull()
+    if err != nil {
+        return nil, err
+    }
+    if addrs, ok := full["srv_addresses"].(List); ok {
+        for _, item := range addrs {
+            d, ok := item.(Dict)
+            if !ok {
+                continue
+            }
+            addSRVAddress(res, d)
+        }
+    }
+
+    orderSRV(res)
+    return res, nil
+}
+
+// LookupSRVTargets looks up the SRV records for name using Service,
+// returning the targets in RFC 2782 order. Targets without addresses
+// in the Service result are looked up with Address.
+func (c *Context) LookupSRVTargets(ctx context.Context, name string) (SRVTargets, error) {
+    res, err := c.ServiceContext(ctx, name, nil)
+    if err != nil {
+        return nil, dnsError(err, name)
+    }
+    defer res.Destroy()
+    err = statusError(res, name)
+    if err != nil {
+        return nil, err
+    }
+    targets, err := res.SRVTargets()
+    if err != nil {
+        return nil, dnsError(err, name)
+    }
+
+    r := NewResolver(c)
+    for i := range targets {
+        if len(targets[i].Addresses) > 0 {
+            continue
+        }
+        // A target that does not resolve is left without addresses.
+        targets[i].Addresses, _ = r.lookupAddresses(ctx, targets[i].Target)
+    }
+    return targets, nil
+}
+
+// addSRVAddress adds the address in an srv_addresses entry to the
+// matching targets.
+func addSRVAddress(targets SRVTargets, d Dict) {
+    name, err := dictName(d, "domain_name")
+    if err != nil {
+        return
+    }
+    data, err := dictBytes(d, "address_data")
+    if err != nil {
+        return
+    }
+    addr, ok := netip.AddrFromSlice(data)
+    if !ok {
+        return
+    }
+    port, err := dictInt(d, "port")
+    if err != nil {
+        port = -1
+    }
+    for i := range targets {
+        t := &targets[i]
+        if canonicalName(t.Target) == canonicalName(name) && (port < 0 || int(t.Port) == port) {
+            t.Addresses = append(t.Addresses, addr.Unmap())
+        }
+    }
+}
+
+// orderSRV sorts targets by priority and, within each priority, by
+// the RFC 2782 weighted random selection.
+func orderSRV(targets []SRVTarget) {
+    sort.SliceStable(targets, func(i, j int) bool {
+        return targets[i].Priority < targets[j].Priority
+    })
+    for start := 0; start < len(targets); {
+        end := start
+        for end < len(targets) && targets[end].Priority == targets[start].Priority {
+            end++
+        }
+        weightedShuffle(targets[start:end])
+        start = end
+    }
+}
+
+// weightedShuffle orders targets of equal priority. Zero weight
+// targets go first in the candidate list, so they are chosen with
+// little chance while others remain.
+func weightedShuffle(targets []SRVTarget) {
+    sort.SliceStable(targets, func(i, j int) bool {
+        return targets[i].Weight == 0 && targets[j].Weight != 0
+    })
+    for i := range targets {
+        total := 0
+        for _, t := range targets[i:] {
+            total += int(t.Weight)
+        }
+        n := rand.Intn(total + 1)
+        sum := 0
+        for j := i; j < len(targets); j++ {
+            sum += int(targets[j].Weight)
+            if sum >= n {
+                selected := targets[j]
+                copy(targets[i+1:j+1], targets[i:j])
+                targets[i] = selected
+                break
+            }
+        }
+    }
+}
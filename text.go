@@ -0,0 +1,70 @@
+package getdns
+
+// #cgo LDFLAGS: -lgetdns
+// #include <getdns/getdns_extra.h>
+import "C"
+
+import (
+    "unsafe"
+)
+
+// RRDictToString converts an RR dict to presentation (zone file)
+// format, as shown by dig.
+func RRDictToString(rr Dict) (string, error) {
+    crr, err := convertDictToC(rr)
+    if err != nil {
+        return "", err
+    }
+    defer C.getdns_dict_destroy(crr)
+
+    var cstr *C.char
+    rc := ReturnCode(C.getdns_rr_dict2str(crr, &cstr))
+    if rc != RETURN_GOOD {
+        return "", &returnCodeError{rc}
+    }
+    defer C.free(unsafe.Pointer(cstr))
+
+    return C.GoString(cstr), nil
+}
+
+// StringToRRDict parses a resource record in presentation (zone file)
+// format into an RR dict. Relative names are completed with origin,
+// and defaultTTL is used if the record has no TTL. origin may be empty
+// if all names are absolute.
+func StringToRRDict(s string, origin string, defaultTTL uint32) (Dict, error) {
+    cstr := C.CString(s)
+    defer C.free(unsafe.Pointer(cstr))
+    var corigin *C.char
+    if origin != "" {
+        corigin = C.CString(origin)
+        defer C.free(unsafe.Pointer(corigin))
+    }
+
+    var rr *C.getdns_dict
+    rc := ReturnCode(C.getdns_str2rr_dict(cstr, &rr, corigin, C.uint32_t(defaultTTL)))
+    if rc != RETURN_GOOD {
+        return nil, &returnCodeError{rc}
+    }
+    defer C.getdns_dict_destroy(rr)
+
+    return convertDictToGo(rr)
+}
+
+// MsgDictToString converts a message dict, such as a reply dict from
+// Result.RepliesTree, to presentation format, as shown by dig.
+func MsgDictToString(msg Dict) (string, error) {
+    cmsg, err := convertDictToC(msg)
+    if err != nil {
+        return "", err
+    }
+    defer C.getdns_dict_destroy(cmsg)
+
+    var cstr *C.char
+    rc := ReturnCode(C.getdns_msg_dict2str(cmsg, &cstr))
+    if rc != RETURN_GOOD {
+        return "", &returnCodeError{rc}
+    }
+    defer C.free(unsafe.Pointer(cstr))
+
+    return C.GoString(cstr), nil
+}
@@ -0,0 +1,432 @@
+package getdns
+
+import (
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+    "unicode"
+)
+
+// DNSKEY flags.
+const (
+    DNSKEY_FLAG_ZONE   = 0x0100
+    DNSKEY_FLAG_REVOKE = 0x0080
+    DNSKEY_FLAG_SEP    = 0x0001
+)
+
+// LoadDNSSECTrustAnchors reads trust anchors from the named file and
+// sets them as the Context trust anchors. The file format is chosen by
+// extension: ".xml" for IANA root-anchors.xml, ".conf" for a BIND
+// trust-anchors, managed-keys or trusted-keys block, and otherwise a
+// zone file of DS and DNSKEY records.
+func (c *Context) LoadDNSSECTrustAnchors(name string) error {
+    f, err := os.Open(name)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    var anchors List
+    switch strings.ToLower(filepath.Ext(name)) {
+    case ".xml":
+        anchors, err = ReadRootAnchorsXML(f, time.Now())
+    case ".conf":
+        anchors, err = ReadBINDTrustAnchors(f)
+    default:
+        anchors, err = ReadTrustAnchorZone(f, "")
+    }
+    if err != nil {
+        return err
+    }
+    return c.SetDNSSECTrustAnchors(anchors)
+}
+
+type xmlTrustAnchor struct {
+    XMLName    xml.Name       `xml:"TrustAnchor"`
+    ID         string         `xml:"id,attr,omitempty"`
+    Source     string         `xml:"source,attr,omitempty"`
+    Zone       string         `xml:"Zone"`
+    KeyDigests []xmlKeyDigest `xml:"KeyDigest"`
+}
+
+type xmlKeyDigest struct {
+    ID         string `xml:"id,attr,omitempty"`
+    ValidFrom  string `xml:"validFrom,attr"`
+    ValidUntil string `xml:"validUntil,attr,omitempty"`
+    KeyTag     uint16 `xml:"KeyTag"`
+    Algorithm  uint8  `xml:"Algorithm"`
+    DigestType uint8  `xml:"DigestType"`
+    Digest     string `xml:"Digest"`
+    PublicKey  string `xml:"PublicKey,omitempty"`
+    Flags      uint16 `xml:"Flags,omitempty"`
+}
+
+// ReadRootAnchorsXML reads trust anchors in the IANA root-anchors.xml
+// format (RFC 7958), returning DS records for the keys valid at time
+// now.
+func ReadRootAnchorsXML(r io.Reader, now time.Time) (List, error) {
+    var ta xmlTrustAnchor
+    err := xml.NewDecoder(r).Decode(&ta)
+    if err != nil {
+        return nil, err
+    }
+
+    var res List
+    for _, kd := range ta.KeyDigests {
+        from, err := time.Parse(time.RFC3339, kd.ValidFrom)
+        if err != nil {
+            return nil, fmt.Errorf("KeyDigest %s: bad validFrom: %s", kd.ID, err)
+        }
+        if now.Before(from) {
+            continue
+        }
+        if kd.ValidUntil != "" {
+            until, err := time.Parse(time.RFC3339, kd.ValidUntil)
+            if err != nil {
+                return nil, fmt.Errorf("KeyDigest %s: bad validUntil: %s", kd.ID, err)
+            }
+            if !now.Before(until) {
+                continue
+            }
+        }
+
+        digest, err := hex.DecodeString(kd.Digest)
+        if err != nil {
+            return nil, fmt.Errorf("KeyDigest %s: bad digest: %s", kd.ID, err)
+        }
+        rr, err := dsAnchor(ta.Zone, &RdataDS{
+            KeyTag:     kd.KeyTag,
+            Algorithm:  kd.Algorithm,
+            DigestType: kd.DigestType,
+            Digest:     digest,
+        })
+        if err != nil {
+            return nil, err
+        }
+        res = append(res, rr)
+    }
+    if len(res) == 0 {
+        return nil, fmt.Errorf("no trust anchors valid at %s", now.Format(time.RFC3339))
+    }
+    return res, nil
+}
+
+// WriteRootAnchorsXML writes trust anchors in the IANA
+// root-anchors.xml format. All anchors must be for the same zone.
+// DNSKEY anchors are written as their SHA-256 digest, with the key
+// included. validFrom is recorded as the start of each key's validity.
+func WriteRootAnchorsXML(w io.Writer, anchors List, validFrom time.Time) error {
+    rrs, err := RRsFromList(anchors)
+    if err != nil {
+        return err
+    }
+
+    ta := xmlTrustAnchor{}
+    for _, rr := range rrs {
+        if ta.Zone == "" {
+            ta.Zone = rr.Name
+        } else if canonicalName(ta.Zone) != canonicalName(rr.Name) {
+            return fmt.Errorf("trust anchors for more than one zone")
+        }
+        rd, err := rr.Decode()
+        if err != nil {
+            return err
+        }
+        kd := xmlKeyDigest{ValidFrom: validFrom.UTC().Format(time.RFC3339)}
+        switch rd := rd.(type) {
+        case *RdataDS:
+            kd.KeyTag = rd.KeyTag
+            kd.Algorithm = rd.Algorithm
+            kd.DigestType = rd.DigestType
+            kd.Digest = strings.ToUpper(hex.EncodeToString(rd.Digest))
+        case *RdataDNSKEY:
+            digest, err := rd.Digest(rr.Name, DIGEST_SHA256)
+            if err != nil {
+                return err
+            }
+            kd.KeyTag = rd.KeyTag()
+            kd.Algorithm = rd.Algorithm
+            kd.DigestType = DIGEST_SHA256
+            kd.Digest = strings.ToUpper(hex.EncodeToString(digest))
+            kd.PublicKey = base64.StdEncoding.EncodeToString(rd.PublicKey)
+            kd.Flags = rd.Flags
+        default:
+            return fmt.Errorf("trust anchor %s is not a DS or DNSKEY", rr.Name)
+        }
+        kd.ID = fmt.Sprintf("K%d", kd.KeyTag)
+        ta.KeyDigests = append(ta.KeyDigests, kd)
+    }
+
+    _, err = io.WriteString(w, xml.Header)
+    if err != nil {
+        return err
+    }
+    enc := xml.NewEncoder(w)
+    enc.Indent("", "  ")
+    err = enc.Encode(&ta)
+    if err != nil {
+        return err
+    }
+    _, err = io.WriteString(w, "\n")
+    return err
+}
+
+// ReadTrustAnchorZone reads DS and DNSKEY trust anchors from a zone
+// file. Other records are ignored, as are revoked DNSKEYs.
+func ReadTrustAnchorZone(r io.Reader, origin string) (List, error) {
+    l, err := ReadZone(r, origin, 0)
+    if err != nil {
+        return nil, err
+    }
+
+    var res List
+    for _, item := range l {
+        d := item.(Dict)
+        rr, err := RRFromDict(d)
+        if err != nil {
+            return nil, err
+        }
+        switch rr.Type {
+        case RRTYPE_DS:
+            res = append(res, d)
+        case RRTYPE_DNSKEY:
+            flags, err := dictInt(rr.Rdata, "flags")
+            if err != nil {
+                return nil, err
+            }
+            if flags&DNSKEY_FLAG_REVOKE == 0 {
+                res = append(res, d)
+            }
+        }
+    }
+    return res, nil
+}
+
+// WriteTrustAnchorZone writes trust anchors as zone file records.
+func WriteTrustAnchorZone(w io.Writer, anchors List) error {
+    for _, item := range anchors {
+        d, ok := item.(Dict)
+        if !ok {
+            return &returnCodeError{RETURN_WRONG_TYPE_REQUESTED}
+        }
+        s, err := RRDictToString(d)
+        if err != nil {
+            return err
+        }
+        _, err = io.WriteString(w, strings.TrimRight(s, "\n")+"\n")
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// ReadBINDTrustAnchors reads trust anchors from BIND configuration
+// containing a trust-anchors, managed-keys or trusted-keys statement.
+// Both static and initial anchors are returned; revoked DNSKEYs are
+// ignored.
+func ReadBINDTrustAnchors(r io.Reader) (List, error) {
+    b, err := io.ReadAll(r)
+    if err != nil {
+        return nil, err
+    }
+    toks, err := bindTokens(string(b))
+    if err != nil {
+        return nil, err
+    }
+
+    var res List
+    for i := 0; i < len(toks); i++ {
+        switch toks[i] {
+        case "trust-anchors", "managed-keys", "trusted-keys":
+        default:
+            continue
+        }
+        trusted := toks[i] == "trusted-keys"
+        i++
+        if i >= len(toks) || toks[i] != "{" {
+            return nil, fmt.Errorf("%s: missing {", toks[i-1])
+        }
+        for i++; i < len(toks) && toks[i] != "}"; i++ {
+            var entry []string
+            for ; i < len(toks) && toks[i] != ";"; i++ {
+                entry = append(entry, toks[i])
+            }
+            if len(entry) == 0 {
+                continue
+            }
+            if trusted {
+                // trusted-keys entries have no anchor type.
+                entry = append([]string{entry[0], "static-key"}, entry[1:]...)
+            }
+            rr, err := bindAnchor(entry)
+            if err != nil {
+                return nil, err
+            }
+            if rr != nil {
+                res = append(res, rr)
+            }
+        }
+    }
+    if len(res) == 0 {
+        return nil, fmt.Errorf("no trust anchors found")
+    }
+    return res, nil
+}
+
+// WriteBINDTrustAnchors writes trust anchors as a BIND trust-anchors
+// statement with static-ds and static-key entries.
+func WriteBINDTrustAnchors(w io.Writer, anchors List) error {
+    rrs, err := RRsFromList(anchors)
+    if err != nil {
+        return err
+    }
+
+    var b strings.Builder
+    b.WriteString("trust-anchors {\n")
+    for _, rr := range rrs {
+        rd, err := rr.Decode()
+        if err != nil {
+            return err
+        }
+        switch rd := rd.(type) {
+        case *RdataDS:
+            fmt.Fprintf(&b, "    %s static-ds %d %d %d \"%s\";\n", rr.Name, rd.KeyTag, rd.Algorithm, rd.DigestType, strings.ToUpper(hex.EncodeToString(rd.Digest)))
+        case *RdataDNSKEY:
+            fmt.Fprintf(&b, "    %s static-key %d %d %d \"%s\";\n", rr.Name, rd.Flags, rd.Protocol, rd.Algorithm, base64.StdEncoding.EncodeToString(rd.PublicKey))
+        default:
+            return fmt.Errorf("trust anchor %s is not a DS or DNSKEY", rr.Name)
+        }
+    }
+    b.WriteString("};\n")
+    _, err = io.WriteString(w, b.String())
+    return err
+}
+
+// bindAnchor converts a BIND trust anchor entry to an RR dict. It
+// returns nil for a revoked key.
+func bindAnchor(entry []string) (Dict, error) {
+    if len(entry) != 6 {
+        return nil, fmt.Errorf("bad trust anchor entry: %s", strings.Join(entry, " "))
+    }
+    var nums [3]int
+    for i, s := range entry[2:5] {
+        n, err := strconv.ParseUint(s, 10, 16)
+        if err != nil {
+            return nil, fmt.Errorf("bad trust anchor entry: %s", strings.Join(entry, " "))
+        }
+        nums[i] = int(n)
+    }
+
+    switch entry[1] {
+    case "static-ds", "initial-ds":
+        digest, err := hex.DecodeString(entry[5])
+        if err != nil {
+            return nil, fmt.Errorf("bad DS digest for %s: %s", entry[0], err)
+        }
+        return dsAnchor(entry[0], &RdataDS{
+            KeyTag:     uint16(nums[0]),
+            Algorithm:  uint8(nums[1]),
+            DigestType: uint8(nums[2]),
+            Digest:     digest,
+        })
+
+    case "static-key", "initial-key":
+        key, err := base64.StdEncoding.DecodeString(entry[5])
+        if err != nil {
+            return nil, fmt.Errorf("bad DNSKEY for %s: %s", entry[0], err)
+        }
+        if nums[0]&DNSKEY_FLAG_REVOKE != 0 {
+            return nil, nil
+        }
+        return dnskeyAnchor(entry[0], &RdataDNSKEY{
+            Flags:     uint16(nums[0]),
+            Protocol:  uint8(nums[1]),
+            Algorithm: uint8(nums[2]),
+            PublicKey: key,
+        })
+
+    default:
+        return nil, fmt.Errorf("unknown trust anchor type %s", entry[1])
+    }
+}
+
+// bindTokens splits BIND configuration into words, quoted strings and
+// the punctuation { } ;, dropping comments. Whitespace inside quoted
+// strings is removed, as it only splits long key data.
+func bindTokens(s string) ([]string, error) {
+    var res []string
+    for i := 0; i < len(s); {
+        c := s[i]
+        switch {
+        case unicode.IsSpace(rune(c)):
+            i++
+        case c == '#' || strings.HasPrefix(s[i:], "//"):
+            for i < len(s) && s[i] != '\n' {
+                i++
+            }
+        case strings.HasPrefix(s[i:], "/*"):
+            end := strings.Index(s[i+2:], "*/")
+            if end < 0 {
+                return nil, fmt.Errorf("unterminated comment")
+            }
+            i += end + 4
+        case c == '{' || c == '}' || c == ';':
+            res = append(res, string(c))
+            i++
+        case c == '"':
+            end := strings.IndexByte(s[i+1:], '"')
+            if end < 0 {
+                return nil, fmt.Errorf("unterminated string")
+            }
+            res = append(res, strings.Join(strings.Fields(s[i+1:i+1+end]), ""))
+            i += end + 2
+        default:
+            start := i
+            for i < len(s) && !unicode.IsSpace(rune(s[i])) && !strings.ContainsRune("{};\"", rune(s[i])) {
+                i++
+            }
+            res = append(res, s[start:i])
+        }
+    }
+    return res, nil
+}
+
+func dsAnchor(name string, ds *RdataDS) (Dict, error) {
+    return anchorDict(name, RRTYPE_DS, Dict{
+        "key_tag":     int(ds.KeyTag),
+        "algorithm":   int(ds.Algorithm),
+        "digest_type": int(ds.DigestType),
+        "digest":      ds.Digest,
+    })
+}
+
+func dnskeyAnchor(name string, key *RdataDNSKEY) (Dict, error) {
+    return anchorDict(name, RRTYPE_DNSKEY, Dict{
+        "flags":      int(key.Flags),
+        "protocol":   int(key.Protocol),
+        "algorithm":  int(key.Algorithm),
+        "public_key": key.PublicKey,
+    })
+}
+
+func anchorDict(name string, rrtype int, rdata Dict) (Dict, error) {
+    wname, err := ConvertFQDNToDNSName(canonicalName(name))
+    if err != nil {
+        return nil, err
+    }
+    return Dict{
+        "name":  wname,
+        "type":  rrtype,
+        "class": RRCLASS_IN,
+        "ttl":   0,
+        "rdata": rdata,
+    }, nil
+}
@@ -43,6 +43,16 @@ func bindataToByteSlice(bindata *C.getdns_bindata) []byte {
     return C.GoBytes(unsafe.Pointer(bindata.data), C.int(bindata.size))
 }
 
+// byteSliceData returns a pointer to the slice data to pass to C, or
+// nil if the slice is empty. Empty bindata are valid in dicts decoded
+// from the wire.
+func byteSliceData(b []byte) *C.uint8_t {
+    if len(b) == 0 {
+        return nil
+    }
+    return (*C.uint8_t)(unsafe.Pointer(&b[0]))
+}
+
 func convertDictToGo(dict *C.getdns_dict) (Dict, error) {
     var keys *C.getdns_list
     var nKeys C.size_t
@@ -210,10 +220,10 @@ func convertDictToC(d Dict) (*C.getdns_dict, error) {
 
         case string:
             b := []byte(val)
-            rc = ReturnCode(C.dict_set_bindata(res, ckey, (*C.uint8_t)(unsafe.Pointer(&b[0])), C.size_t(len(b))))
+            rc = ReturnCode(C.dict_set_bindata(res, ckey, byteSliceData(b), C.size_t(len(b))))
 
         case []byte:
-            rc = ReturnCode(C.dict_set_bindata(res, ckey, (*C.uint8_t)(unsafe.Pointer(&val[0])), C.size_t(len(val))))
+            rc = ReturnCode(C.dict_set_bindata(res, ckey, byteSliceData(val), C.size_t(len(val))))
 
         case Dict:
             d, err := convertDictToC(val)
@@ -264,10 +274,10 @@ func convertListToC(l List) (*C.getdns_list, error) {
 
         case string:
             b := []byte(val)
-            rc = ReturnCode(C.list_set_bindata(res, C.size_t(i), (*C.uint8_t)(unsafe.Pointer(&b[0])), C.size_t(len(b))))
+            rc = ReturnCode(C.list_set_bindata(res, C.size_t(i), byteSliceData(b), C.size_t(len(b))))
 
         case []byte:
-            rc = ReturnCode(C.list_set_bindata(res, C.size_t(i), (*C.uint8_t)(unsafe.Pointer(&val[0])), C.size_t(len(val))))
+            rc = ReturnCode(C.list_set_bindata(res, C.size_t(i), byteSliceData(val), C.size_t(len(val))))
 
         case Dict:
             d, err := convertDictToC(val)
@@ -432,92 +442,123 @@ func makeAddressDictList(list *C.getdns_list) ([]Dict, error) {
     return res, nil
 }
 
+// libraryVersion is the getdns version built against, which decides
+// the extensions available.
+const libraryVersion = C.GETDNS_NUMERIC_VERSION
+
+// returnCallReportingKey returns the name of the call reporting
+// extension, which was return_call_debugging before getdns 0.9.0.
+func returnCallReportingKey() string {
+    if libraryVersion < 0x00090000 {
+        return "return_call_debugging"
+    }
+    return "return_call_reporting"
+}
+
 func checkExtensions(exts Dict) error {
     if exts == nil {
         return nil
     }
 
-    var retcall string
-    var ok bool
-    if C.GETDNS_NUMERIC_VERSION < 0x00090000 {
-        retcall = "return_call_debugging"
-    } else {
-        retcall = "return_call_reporting"
-    }
     for key, item := range exts {
-        switch key {
-        case retcall,
-            "add_warning_for_bad_dns",
-            "dnssec_return_status",
-            "dnssec_return_all_statuses",
-            "dnssec_return_only_secure",
-            "dnssec_return_validation_chain",
-            "return_api_information",
-            "return_both_v4_and_v6":
+        spec, ok := extensionSpecs[key]
+        if !ok || !spec.supported() {
+            return &returnCodeError{RETURN_NO_SUCH_EXTENSION}
+        }
+
+        var err error
+        switch spec.kind {
+        case extensionBool:
             ival, ok := item.(int)
             if !ok || (ival != EXTENSION_TRUE && ival != EXTENSION_FALSE) {
-                return &returnCodeError{RETURN_EXTENSION_MISFORMAT}
+                err = &returnCodeError{RETURN_EXTENSION_MISFORMAT}
             }
 
-        case "specify_class":
-            _, ok = item.(int)
+        case extensionInt:
+            if _, ok := item.(int); !ok {
+                err = &returnCodeError{RETURN_EXTENSION_MISFORMAT}
+            }
+
+        case extensionOptParameters:
+            err = checkOptParameters(item)
+
+        case extensionHeader:
+            err = checkHeaderExtension(item)
+        }
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+func checkOptParameters(item interface{}) error {
+    optdict, ok := item.(Dict)
+    if !ok {
+        return &returnCodeError{RETURN_EXTENSION_MISFORMAT}
+    }
+    for optkey, optval := range optdict {
+        switch optkey {
+        case "maximum_udp_payload_size",
+            "extended_rcode",
+            "version",
+            "do_bit":
+            _, ok = optval.(int)
             if !ok {
                 return &returnCodeError{RETURN_EXTENSION_MISFORMAT}
             }
 
-        case "add_opt_parameters":
-            optdict, ok := item.(Dict)
+        case "options":
+            l, ok := optval.(List)
             if !ok {
                 return &returnCodeError{RETURN_EXTENSION_MISFORMAT}
             }
-            for optkey, optval := range optdict {
-                switch optkey {
-                case "maximum_udp_payload_size",
-                    "extended_rcode",
-                    "version",
-                    "do_bit":
-                    _, ok = optval.(int)
-                    if !ok {
-                        return &returnCodeError{RETURN_EXTENSION_MISFORMAT}
-                    }
+            for _, listitem := range l {
+                ld, ok := listitem.(Dict)
+                if !ok {
+                    return &returnCodeError{RETURN_EXTENSION_MISFORMAT}
+                }
+                for lkey, ldata := range ld {
+                    switch lkey {
+                    case "option_code":
+                        _, ok = ldata.(int)
 
-                case "options":
-                    l, ok := optval.(List)
-                    if !ok {
-                        return &returnCodeError{RETURN_EXTENSION_MISFORMAT}
-                    }
-                    for _, listitem := range l {
-                        ld, ok := listitem.(Dict)
-                        if !ok {
-                            return &returnCodeError{RETURN_EXTENSION_MISFORMAT}
-                        }
-                        for lkey, ldata := range ld {
-                            switch lkey {
-                            case "option_code":
-                                _, ok = ldata.(int)
-
-                            case "option_data":
-                                _, ok = ldata.([]byte)
-
-                            default:
-                                ok = false
-                            }
-                        }
-                        if !ok {
-                            return &returnCodeError{RETURN_EXTENSION_MISFORMAT}
-                        }
-                    }
+                    case "option_data":
+                        _, ok = ldata.([]byte)
 
-                default:
+                    default:
+                        ok = false
+                    }
+                }
+                if !ok {
                     return &returnCodeError{RETURN_EXTENSION_MISFORMAT}
                 }
             }
 
         default:
-            return &returnCodeError{RETURN_NO_SUCH_EXTENSION}
+            return &returnCodeError{RETURN_EXTENSION_MISFORMAT}
         }
     }
+    return nil
+}
+
+func checkHeaderExtension(item interface{}) error {
+    hd, ok := item.(Dict)
+    if !ok {
+        return &returnCodeError{RETURN_EXTENSION_MISFORMAT}
+    }
+    for key, val := range hd {
+        switch key {
+        case "id", "qr", "opcode", "aa", "tc", "rd", "ra", "z", "ad", "cd", "rcode":
+            if _, ok := val.(int); !ok {
+                return &returnCodeError{RETURN_EXTENSION_MISFORMAT}
+            }
 
+        default:
+            return &returnCodeError{RETURN_EXTENSION_MISFORMAT}
+        }
+    }
     return nil
 }
 
@@ -587,3 +628,59 @@ func (d *Dict) String() (res string) {
     }
     return res + "}"
 }
+
+func dictInt(d Dict, key string) (int, error) {
+    item, ok := d[key]
+    if !ok {
+        return 0, &returnCodeError{RETURN_NO_SUCH_DICT_NAME}
+    }
+    val, ok := item.(int)
+    if !ok {
+        return 0, &returnCodeError{RETURN_WRONG_TYPE_REQUESTED}
+    }
+    return val, nil
+}
+
+func dictBytes(d Dict, key string) ([]byte, error) {
+    item, ok := d[key]
+    if !ok {
+        return nil, &returnCodeError{RETURN_NO_SUCH_DICT_NAME}
+    }
+    val, ok := item.([]byte)
+    if !ok {
+        return nil, &returnCodeError{RETURN_WRONG_TYPE_REQUESTED}
+    }
+    return val, nil
+}
+
+func dictName(d Dict, key string) (string, error) {
+    b, err := dictBytes(d, key)
+    if err != nil {
+        return "", err
+    }
+    return ConvertDNSNameToFQDN(b)
+}
+
+func dictDict(d Dict, key string) (Dict, error) {
+    item, ok := d[key]
+    if !ok {
+        return nil, &returnCodeError{RETURN_NO_SUCH_DICT_NAME}
+    }
+    val, ok := item.(Dict)
+    if !ok {
+        return nil, &returnCodeError{RETURN_WRONG_TYPE_REQUESTED}
+    }
+    return val, nil
+}
+
+func dictList(d Dict, key string) (List, error) {
+    item, ok := d[key]
+    if !ok {
+        return nil, &returnCodeError{RETURN_NO_SUCH_DICT_NAME}
+    }
+    val, ok := item.(List)
+    if !ok {
+        return nil, &returnCodeError{RETURN_WRONG_TYPE_REQUESTED}
+    }
+    return val, nil
+}
@@ -0,0 +1,89 @@
+package getdns
+
+// #cgo LDFLAGS: -lgetdns
+// #include <getdns/getdns_extra.h>
+import "C"
+
+import (
+    "unsafe"
+)
+
+// WireToMsgDict converts a DNS message in wire format to a message
+// dict, in the form of the reply dicts in Result.RepliesTree.
+func WireToMsgDict(wire []byte) (Dict, error) {
+    if len(wire) == 0 {
+        return nil, &returnCodeError{RETURN_INVALID_PARAMETER}
+    }
+    var msg *C.getdns_dict
+    rc := ReturnCode(C.getdns_wire2msg_dict((*C.uint8_t)(unsafe.Pointer(&wire[0])), C.size_t(len(wire)), &msg))
+    if rc != RETURN_GOOD {
+        return nil, &returnCodeError{rc}
+    }
+    defer C.getdns_dict_destroy(msg)
+
+    return convertDictToGo(msg)
+}
+
+// MsgDictToWire converts a message dict to a DNS message in wire
+// format.
+func MsgDictToWire(msg Dict) ([]byte, error) {
+    cmsg, err := convertDictToC(msg)
+    if err != nil {
+        return nil, err
+    }
+    defer C.getdns_dict_destroy(cmsg)
+
+    var wire *C.uint8_t
+    var wireSize C.size_t
+    rc := ReturnCode(C.getdns_msg_dict2wire(cmsg, &wire, &wireSize))
+    if rc != RETURN_GOOD {
+        return nil, &returnCodeError{rc}
+    }
+    defer C.free(unsafe.Pointer(wire))
+
+    return C.GoBytes(unsafe.Pointer(wire), C.int(wireSize)), nil
+}
+
+// WireToRRDict converts a resource record in wire format to an RR
+// dict, in the form of the records in reply dicts.
+func WireToRRDict(wire []byte) (Dict, error) {
+    if len(wire) == 0 {
+        return nil, &returnCodeError{RETURN_INVALID_PARAMETER}
+    }
+    var rr *C.getdns_dict
+    rc := ReturnCode(C.getdns_wire2rr_dict((*C.uint8_t)(unsafe.Pointer(&wire[0])), C.size_t(len(wire)), &rr))
+    if rc != RETURN_GOOD {
+        return nil, &returnCodeError{rc}
+    }
+    defer C.getdns_dict_destroy(rr)
+
+    return convertDictToGo(rr)
+}
+
+// RRDictToWire converts an RR dict to a resource record in wire format.
+func RRDictToWire(rr Dict) ([]byte, error) {
+    crr, err := convertDictToC(rr)
+    if err != nil {
+        return nil, err
+    }
+    defer C.getdns_dict_destroy(crr)
+
+    var wire *C.uint8_t
+    var wireSize C.size_t
+    rc := ReturnCode(C.getdns_rr_dict2wire(crr, &wire, &wireSize))
+    if rc != RETURN_GOOD {
+        return nil, &returnCodeError{rc}
+    }
+    defer C.free(unsafe.Pointer(wire))
+
+    return C.GoBytes(unsafe.Pointer(wire), C.int(wireSize)), nil
+}
+
+// ReplyFromWire decodes a DNS message in wire format into a Reply.
+func ReplyFromWire(wire []byte) (*Reply, error) {
+    msg, err := WireToMsgDict(wire)
+    if err != nil {
+        return nil, err
+    }
+    return ReplyFromDict(msg)
+}
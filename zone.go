@@ -0,0 +1,317 @@
+package getdns
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// maxIncludeDepth limits nesting of $INCLUDE directives.
+const maxIncludeDepth = 16
+
+// ZoneParseError reports a problem in a zone file.
+type ZoneParseError struct {
+    File string // Empty if reading from an io.Reader.
+    Line int
+    Err  error
+}
+
+func (err *ZoneParseError) Error() string {
+    if err.File == "" {
+        return fmt.Sprintf("line %d: %s", err.Line, err.Err)
+    }
+    return fmt.Sprintf("%s:%d: %s", err.File, err.Line, err.Err)
+}
+
+func (err *ZoneParseError) Unwrap() error {
+    return err.Err
+}
+
+type zoneParser struct {
+    origin    string
+    ttl       uint32
+    ttlSet    bool
+    lastOwner string
+    depth     int
+    res       List
+}
+
+// ReadZone reads the resource records in a zone file and returns a
+// list of RR dicts. Relative names are completed with origin, which
+// may be changed by $ORIGIN in the file. defaultTTL applies to records
+// without a TTL until a $TTL directive is seen. $INCLUDE file names
+// are relative to the current directory.
+func ReadZone(r io.Reader, origin string, defaultTTL uint32) (List, error) {
+    p := newZoneParser(origin, defaultTTL)
+    err := p.read(r, "")
+    if err != nil {
+        return nil, err
+    }
+    return p.res, nil
+}
+
+// ReadZoneFile reads the resource records in the named zone file.
+// $INCLUDE file names are relative to the directory of the including
+// file.
+func ReadZoneFile(name string, origin string, defaultTTL uint32) (List, error) {
+    p := newZoneParser(origin, defaultTTL)
+    err := p.readFile(name)
+    if err != nil {
+        return nil, err
+    }
+    return p.res, nil
+}
+
+func newZoneParser(origin string, defaultTTL uint32) *zoneParser {
+    if origin != "" && !strings.HasSuffix(origin, ".") {
+        origin += "."
+    }
+    return &zoneParser{origin: origin, ttl: defaultTTL}
+}
+
+func (p *zoneParser) readFile(name string) error {
+    f, err := os.Open(name)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    return p.read(f, name)
+}
+
+func (p *zoneParser) read(r io.Reader, file string) error {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+    lineNo := 0
+    for {
+        // Collect a logical line, which may continue over several
+        // physical lines inside parentheses.
+        var text strings.Builder
+        startLine := 0
+        blankOwner := false
+        depth := 0
+        for scanner.Scan() {
+            lineNo++
+            line := scanner.Text()
+            if startLine == 0 {
+                if strings.TrimSpace(stripComment(line)) == "" {
+                    continue
+                }
+                startLine = lineNo
+                blankOwner = line[0] == ' ' || line[0] == '\t'
+            }
+            var err error
+            depth, err = appendZoneText(&text, line, depth)
+            if err != nil {
+                return &ZoneParseError{File: file, Line: lineNo, Err: err}
+            }
+            if depth == 0 {
+                break
+            }
+        }
+        if err := scanner.Err(); err != nil {
+            return &ZoneParseError{File: file, Line: lineNo, Err: err}
+        }
+        if startLine == 0 {
+            return nil
+        }
+        if depth != 0 {
+            return &ZoneParseError{File: file, Line: startLine, Err: fmt.Errorf("unbalanced parentheses")}
+        }
+
+        err := p.entry(strings.TrimSpace(text.String()), blankOwner, file)
+        if err != nil {
+            if _, ok := err.(*ZoneParseError); ok {
+                return err
+            }
+            return &ZoneParseError{File: file, Line: startLine, Err: err}
+        }
+    }
+}
+
+// entry handles a single logical line: a directive or a record.
+func (p *zoneParser) entry(text string, blankOwner bool, file string) error {
+    fields := strings.Fields(text)
+    if len(fields) == 0 {
+        return fmt.Errorf("empty entry")
+    }
+    switch strings.ToUpper(fields[0]) {
+    case "$ORIGIN":
+        if len(fields) != 2 {
+            return fmt.Errorf("bad $ORIGIN")
+        }
+        p.origin = p.absolute(fields[1])
+        return nil
+
+    case "$TTL":
+        if len(fields) != 2 {
+            return fmt.Errorf("bad $TTL")
+        }
+        ttl, err := parseTTL(fields[1])
+        if err != nil {
+            return err
+        }
+        p.ttl = ttl
+        p.ttlSet = true
+        return nil
+
+    case "$INCLUDE":
+        if len(fields) < 2 || len(fields) > 3 {
+            return fmt.Errorf("bad $INCLUDE")
+        }
+        if p.depth >= maxIncludeDepth {
+            return fmt.Errorf("$INCLUDE nested too deeply")
+        }
+        name := fields[1]
+        if file != "" && !filepath.IsAbs(name) {
+            name = filepath.Join(filepath.Dir(file), name)
+        }
+        // The included file may set its own origin, but it does not
+        // affect the including file.
+        origin := p.origin
+        if len(fields) == 3 {
+            p.origin = p.absolute(fields[2])
+        }
+        p.depth++
+        err := p.readFile(name)
+        p.depth--
+        p.origin = origin
+        return err
+    }
+
+    if blankOwner {
+        if p.lastOwner == "" {
+            return fmt.Errorf("no previous owner name")
+        }
+        text = p.lastOwner + " " + text
+    } else if fields[0] == "@" {
+        if p.origin == "" {
+            return fmt.Errorf("@ used with no origin")
+        }
+        text = p.origin + text[1:]
+    }
+
+    rr, err := StringToRRDict(text, p.origin, p.ttl)
+    if err != nil {
+        return err
+    }
+    owner, err := dictName(rr, "name")
+    if err != nil {
+        return err
+    }
+    p.lastOwner = owner
+    // Without $TTL, the last explicit TTL is the default (RFC 1035).
+    if !p.ttlSet {
+        if ttl, err := dictInt(rr, "ttl"); err == nil {
+            p.ttl = uint32(ttl)
+        }
+    }
+    p.res = append(p.res, rr)
+    return nil
+}
+
+// absolute completes a relative name with the current origin.
+func (p *zoneParser) absolute(name string) string {
+    if strings.HasSuffix(name, ".") {
+        return name
+    }
+    if name == "@" {
+        return p.origin
+    }
+    if p.origin == "." || p.origin == "" {
+        return name + "."
+    }
+    return name + "." + p.origin
+}
+
+// stripComment removes a comment from a zone file line.
+func stripComment(line string) string {
+    quoted := false
+    for i := 0; i < len(line); i++ {
+        switch line[i] {
+        case '\\':
+            i++
+        case '"':
+            quoted = !quoted
+        case ';':
+            if !quoted {
+                return line[:i]
+            }
+        }
+    }
+    return line
+}
+
+// appendZoneText appends a zone file line, less comments and
+// parentheses, to text. It returns the parenthesis depth at the end
+// of the line.
+func appendZoneText(text *strings.Builder, line string, depth int) (int, error) {
+    line = stripComment(line)
+    quoted := false
+    text.WriteByte(' ')
+    for i := 0; i < len(line); i++ {
+        c := line[i]
+        switch {
+        case c == '\\' && i+1 < len(line):
+            text.WriteByte(c)
+            i++
+            c = line[i]
+        case c == '"':
+            quoted = !quoted
+        case c == '(' && !quoted:
+            depth++
+            c = ' '
+        case c == ')' && !quoted:
+            depth--
+            if depth < 0 {
+                return depth, fmt.Errorf("unbalanced parentheses")
+            }
+            c = ' '
+        }
+        text.WriteByte(c)
+    }
+    return depth, nil
+}
+
+// parseTTL parses a TTL in seconds, or with BIND-style unit suffixes
+// such as 1h30m.
+func parseTTL(s string) (uint32, error) {
+    if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+        return uint32(n), nil
+    }
+    var total, n uint64
+    digits := false
+    for _, c := range strings.ToLower(s) {
+        if c >= '0' && c <= '9' {
+            n = n*10 + uint64(c-'0')
+            digits = true
+            continue
+        }
+        if !digits {
+            return 0, fmt.Errorf("bad TTL %q", s)
+        }
+        switch c {
+        case 's':
+        case 'm':
+            n *= 60
+        case 'h':
+            n *= 60 * 60
+        case 'd':
+            n *= 24 * 60 * 60
+        case 'w':
+            n *= 7 * 24 * 60 * 60
+        default:
+            return 0, fmt.Errorf("bad TTL %q", s)
+        }
+        total += n
+        n = 0
+        digits = false
+    }
+    if digits || total > 1<<32-1 {
+        return 0, fmt.Errorf("bad TTL %q", s)
+    }
+    return uint32(total), nil
+}